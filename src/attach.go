@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// detachKey is Ctrl-], the same escape telnet and virsh console use.
+const detachKey = 0x1d
+
+func cmdAttach(id string, sm *SessionManager) error {
+	if s, err := sm.Read(id); err == nil && !s.Detached {
+		return fmt.Errorf("session %s is running in the foreground; only sessions started with --detach can be attached", id)
+	}
+	conn, err := dialSession(id, sm)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, frameAttach, nil); err != nil {
+		return fmt.Errorf("failed to attach to session %s: %w", id, err)
+	}
+
+	fmt.Printf("Attached to session %s. Press Ctrl-] to detach.\r\n", id)
+	if oldState, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+		defer term.Restore(int(os.Stdin.Fd()), oldState)
+	}
+
+	// The session takes on our size while we're attached
+	sendSize := func() {
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			writeFrame(conn, frameResize, encodeSize(w, h))
+		}
+	}
+	sendSize()
+	defer notifyResize(sendSize)()
+
+	// Session output -> real stdout, until the supervisor hangs up or we detach
+	done := streamOutput(conn)
+
+	// Real stdin -> session input, watching for the detach key
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				if i := bytes.IndexByte(buf[:n], detachKey); i >= 0 {
+					if i > 0 {
+						writeFrame(conn, frameData, buf[:i])
+					}
+					conn.Close()
+					return
+				}
+				if writeFrame(conn, frameData, buf[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	<-done
+	return reportDetach(id, sm)
+}
+
+// streamOutput copies output frames from conn to stdout. The returned channel
+// is closed when the connection ends.
+func streamOutput(conn net.Conn) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for {
+			typ, payload, err := readFrame(conn)
+			if err != nil {
+				break
+			}
+			if typ == frameData {
+				os.Stdout.Write(payload)
+			}
+		}
+		close(done)
+	}()
+	return done
+}
+
+func cmdWatch(target string, sm *SessionManager) error {
+	id, err := resolveRunningSession(target, sm)
+	if err != nil {
+		return err
+	}
+	conn, err := dialSession(id, sm)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, frameWatch, nil); err != nil {
+		return fmt.Errorf("failed to watch session %s: %w", id, err)
+	}
+
+	fmt.Printf("Watching session %s (read-only). Press q or Ctrl-C to stop.\r\n", id)
+	// Raw mode keeps keystrokes from echoing over the mirrored output
+	if oldState, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+		defer term.Restore(int(os.Stdin.Fd()), oldState)
+	}
+
+	done := streamOutput(conn)
+
+	// Keystrokes are never forwarded; only watch for the quit keys
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if bytes.ContainsAny(buf[:n], "q\x03\x1d") {
+				conn.Close()
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	<-done
+	if s, err := sm.Read(id); err == nil && s.Alive && isProcessAlive(s.PID) {
+		fmt.Printf("\r\nStopped watching session %s.\r\n", id)
+	} else {
+		fmt.Printf("\r\nSession %s exited.\r\n", id)
+	}
+	return nil
+}
+
+// reportDetach tells the user whether the session is still running after the
+// client connection ended.
+func reportDetach(id string, sm *SessionManager) error {
+	s, err := sm.Read(id)
+	if err == nil && s.Alive && isProcessAlive(s.PID) {
+		fmt.Printf("\r\nDetached from session %s. Reattach with: nt attach %s\r\n", id, id)
+		return nil
+	}
+	fmt.Printf("\r\nSession %s exited.\r\n", id)
+	return nil
+}
+
+func cmdDetach(id string, sm *SessionManager) error {
+	conn, err := dialSession(id, sm)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, frameDetach, nil); err != nil {
+		return fmt.Errorf("failed to detach session %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recording stops once a cast file reaches this size. Unlike the plain log it
+// can't be rotated without breaking playback, so keep the start instead.
+const castMaxBytes = 32 << 20
+
+// castRecorder writes a session's PTY output as an asciinema v2 recording:
+// a JSON header line followed by one [elapsed, type, data] event per line.
+type castRecorder struct {
+	mu      sync.Mutex // output and resizes arrive on different goroutines
+	f       *os.File
+	start   time.Time
+	size    int64
+	pending []byte // incomplete UTF-8 sequence carried over from the last chunk
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func openCastRecorder(path string, cols, rows int, title string) (*castRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session recording: %w", err)
+	}
+	start := time.Now()
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"SHELL": os.Getenv("SHELL"), "TERM": os.Getenv("TERM")},
+	})
+	n, err := f.Write(append(header, '\n'))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write session recording: %w", err)
+	}
+	return &castRecorder{f: f, start: start, size: int64(n)}, nil
+}
+
+// Output records a chunk of PTY output.
+func (c *castRecorder) Output(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data := append(c.pending, p...)
+	// Hold back a trailing partial rune so multi-byte characters split across
+	// reads aren't turned into replacement characters by the JSON encoder
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	c.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		c.event("o", string(data[:cut]))
+	}
+}
+
+// Resize records a terminal size change.
+func (c *castRecorder) Resize(cols, rows int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (c *castRecorder) event(typ string, data string) {
+	if c.size >= castMaxBytes {
+		return
+	}
+	line, _ := json.Marshal([]any{time.Since(c.start).Seconds(), typ, data})
+	n, _ := c.f.Write(append(line, '\n'))
+	c.size += int64(n)
+}
+
+func (c *castRecorder) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) > 0 {
+		c.event("o", string(c.pending))
+	}
+	return c.f.Close()
+}
+
+func cmdReplay(args []string, sm *SessionManager) error {
+	id := ""
+	speed := 1.0
+	var idleCap time.Duration
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--speed" && i+1 < len(args):
+			v, err := strconv.ParseFloat(strings.TrimSuffix(args[i+1], "x"), 64)
+			if err != nil || v <= 0 {
+				return fmt.Errorf("invalid --speed %q (e.g. 2x or 0.5)", args[i+1])
+			}
+			speed = v
+			i++
+		case args[i] == "--idle-cap" && i+1 < len(args):
+			d, err := parseDurationArg(args[i+1])
+			if err != nil {
+				return fmt.Errorf("invalid --idle-cap %q (e.g. 2s)", args[i+1])
+			}
+			idleCap = d
+			i++
+		default:
+			id = args[i]
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("usage: nt replay <session-id> [--speed 2x] [--idle-cap 2s]")
+	}
+
+	f, err := os.Open(sm.CastPath(id))
+	if err != nil {
+		return fmt.Errorf("no recording for session %s", id)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+	if !scanner.Scan() {
+		return fmt.Errorf("recording for session %s is empty", id)
+	}
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != 2 {
+		return fmt.Errorf("recording for session %s is not an asciicast v2 file", id)
+	}
+
+	fmt.Print("\033[2J\033[H") // start from a clear screen, like the session did
+	last := 0.0
+	for scanner.Scan() {
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			continue
+		}
+		at, ok1 := event[0].(float64)
+		typ, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			continue
+		}
+		wait := time.Duration((at - last) * float64(time.Second))
+		if idleCap > 0 && wait > idleCap {
+			wait = idleCap
+		}
+		time.Sleep(time.Duration(float64(wait) / speed))
+		last = at
+		if typ == "o" {
+			os.Stdout.WriteString(data)
+		}
+	}
+	fmt.Print("\033[0m\n")
+	return nil
+}
+
+// parseDurationArg accepts Go durations like 2s or 1m30s, or bare seconds.
+func parseDurationArg(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
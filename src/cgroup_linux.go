@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupLimiter puts a session in its own cgroup v2 group, which limits the
+// whole process tree together and records when a limit was hit.
+type cgroupLimiter struct {
+	dir string
+}
+
+// newCgroupLimiter creates a group for the session next to our own cgroup,
+// which works when the user has a delegated subtree (e.g. a systemd user
+// session). The CPU weight can fall back to a nice value, so when it can't
+// go in a group it's returned for the caller to apply that way. The memory
+// and process limits have no fallback, so failing to apply them is an error.
+func newCgroupLimiter(id string, l resourceLimits) (limiter, resourceLimits, error) {
+	c, err := createCgroup(id, l)
+	if err == nil {
+		return c, resourceLimits{}, nil
+	}
+	if l.CPUWeight > 0 {
+		nice := resourceLimits{CPUWeight: l.CPUWeight}
+		l.CPUWeight = 0
+		if l.empty() {
+			return nil, nice, nil
+		}
+		if c, err = createCgroup(id, l); err == nil {
+			return c, nice, nil
+		}
+	}
+	return nil, resourceLimits{}, fmt.Errorf("failed to apply --max-mem and --max-procs: %w", err)
+}
+
+func createCgroup(id string, l resourceLimits) (*cgroupLimiter, error) {
+	parent, err := cgroupParent(l)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(parent, "nanotown-"+id)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("failed to create the session's cgroup: %w", err)
+	}
+	c := &cgroupLimiter{dir: dir}
+	var settings [][2]string
+	if l.MaxMem > 0 {
+		settings = append(settings, [2]string{"memory.max", strconv.FormatInt(l.MaxMem, 10)})
+	}
+	if l.MaxProcs > 0 {
+		settings = append(settings, [2]string{"pids.max", strconv.Itoa(l.MaxProcs)})
+	}
+	if l.CPUWeight > 0 {
+		settings = append(settings, [2]string{"cpu.weight", strconv.Itoa(l.CPUWeight)})
+	}
+	for _, s := range settings {
+		if err := os.WriteFile(filepath.Join(dir, s[0]), []byte(s[1]), 0644); err != nil {
+			c.release()
+			return nil, fmt.Errorf("failed to set %s: %w", s[0], err)
+		}
+	}
+	if l.MaxMem > 0 {
+		// Otherwise a tree over its limit swaps instead of being stopped
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0644) // best-effort
+	}
+	return c, nil
+}
+
+// startInCgroup makes cmd start inside the limiter's group rather than be
+// moved there afterwards, so nothing the session runs is ever outside it.
+// The returned func closes the group's descriptor once cmd has started.
+func startInCgroup(l limiter, cmd *exec.Cmd) (func(), error) {
+	f, err := os.Open(l.(*cgroupLimiter).dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the session's cgroup: %w", err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return func() { f.Close() }, nil
+}
+
+// cgroupParent returns the cgroup a session's group would be created in: our
+// own cgroup's parent, whose siblings get the controllers enabled in its
+// subtree_control. Fails if that doesn't have the controllers l needs.
+func cgroupParent(l resourceLimits) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("no cgroup v2 hierarchy at %s", cgroupRoot)
+	}
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("failed to read our cgroup: %w", err)
+	}
+	own := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			own = path
+		}
+	}
+	if own == "" {
+		return "", fmt.Errorf("not in a cgroup v2 group")
+	}
+
+	parent := filepath.Join(cgroupRoot, filepath.Dir(own))
+	data, err = os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", parent, err)
+	}
+	enabled := map[string]bool{}
+	for _, c := range strings.Fields(string(data)) {
+		enabled[c] = true
+	}
+	missing := ""
+	switch {
+	case l.MaxMem > 0 && !enabled["memory"]:
+		missing = "memory"
+	case l.MaxProcs > 0 && !enabled["pids"]:
+		missing = "pids"
+	case l.CPUWeight > 0 && !enabled["cpu"]:
+		missing = "cpu"
+	}
+	if missing != "" {
+		return "", fmt.Errorf("the %s controller isn't enabled in %s", missing, parent)
+	}
+	return parent, nil
+}
+
+// checkLimits fails early if the memory or process limit can't be enforced,
+// before a worktree is set up for the session.
+func checkLimits(l resourceLimits) error {
+	if l.MaxMem == 0 && l.MaxProcs == 0 {
+		return nil
+	}
+	l.CPUWeight = 0 // falls back to a nice value
+	if _, err := cgroupParent(l); err != nil {
+		return fmt.Errorf("--max-mem and --max-procs need a delegated cgroup v2 subtree: %w", err)
+	}
+	return nil
+}
+
+func (c *cgroupLimiter) add(pid int) error {
+	if err := os.WriteFile(filepath.Join(c.dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("failed to move session into its cgroup: %w", err)
+	}
+	return nil
+}
+
+// hit checks the group's event counters for OOM kills and refused forks.
+func (c *cgroupLimiter) hit() string {
+	if cgroupEvent(filepath.Join(c.dir, "memory.events"), "oom_kill") > 0 {
+		return exitReasonMemLimit
+	}
+	if cgroupEvent(filepath.Join(c.dir, "pids.events"), "max") > 0 {
+		return exitReasonProcLimit
+	}
+	return ""
+}
+
+// release removes the group. This fails while any process in it is still
+// running, in which case it's left for the kernel to report until they exit.
+func (c *cgroupLimiter) release() {
+	os.Remove(c.dir) // best-effort
+}
+
+// cgroupEvent reads one counter from a flat-keyed cgroup events file.
+func cgroupEvent(path string, key string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
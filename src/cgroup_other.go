@@ -0,0 +1,30 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// newCgroupLimiter leaves the CPU weight to be applied as a nice value, and
+// fails for the other limits: cgroups are Linux-only.
+func newCgroupLimiter(id string, l resourceLimits) (limiter, resourceLimits, error) {
+	if err := checkLimits(l); err != nil {
+		return nil, resourceLimits{}, err
+	}
+	return nil, l, nil
+}
+
+// startInCgroup is never called: there's never a cgroup limiter here.
+func startInCgroup(l limiter, cmd *exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
+
+// checkLimits fails for the memory and process limits.
+func checkLimits(l resourceLimits) error {
+	if l.MaxMem > 0 || l.MaxProcs > 0 {
+		return fmt.Errorf("--max-mem and --max-procs need cgroups, which are Linux-only")
+	}
+	return nil
+}
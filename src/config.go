@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// repoConfigFile holds per-repo session defaults. It lives at the repo root so
+// it can be checked in alongside the code.
+const repoConfigFile = ".nanotown.json"
+
+// userConfigFile holds the user's own defaults, in the same format. Anything
+// the repo's file sets takes precedence, and CLI flags override both.
+const userConfigFile = "config" // in ~/.nanotown
+
+// profilesFile holds named agent setups, each in the config format, selected
+// with nt -p. A profile overrides the repo's config; CLI flags still win.
+const profilesFile = "profiles.json" // in ~/.nanotown
+
+// repoConfig is the effective config for a repo. Sizes and durations are
+// strings so they can be written the same way as on the command line.
+type repoConfig struct {
+	Command []string          `json:"command,omitempty"` // run instead of an interactive shell when no -- is given
+	Env     map[string]string `json:"env,omitempty"`     // set for the session and its hooks; $VARS are expanded
+	Setup   []string          `json:"setup,omitempty"`   // shell commands run in each new worktree, in order
+	Include includeConfig     `json:"include"`           // untracked files to bring into each new worktree
+
+	WorktreeRoot string `json:"worktreeRoot,omitempty"` // create worktrees in <worktreeRoot>/<repo name>-<hash>/ instead of .nanotown/
+
+	Ports     int    `json:"ports,omitempty"`     // TCP ports reserved per session, exported as NT_PORT...
+	PortRange string `json:"portRange,omitempty"` // where ports are allocated from, "lo-hi"
+
+	MaxMem    string `json:"maxMem,omitempty"`
+	MaxProcs  int    `json:"maxProcs,omitempty"`
+	CPUWeight int    `json:"cpuWeight,omitempty"`
+
+	IdleTimeout     string `json:"idleTimeout,omitempty"`
+	MaxRuntime      string `json:"maxRuntime,omitempty"`
+	Restart         string `json:"restart,omitempty"`         // default --restart policy
+	StopSequence    string `json:"stopSequence,omitempty"`    // default --sequence for nt stop
+	ActiveThreshold string `json:"activeThreshold,omitempty"` // how long after its last output a session still counts as active
+
+	InputPatterns []string `json:"inputPatterns,omitempty"` // regexps for prompts that mean a session needs input
+
+	Notify notifyConfig `json:"notify"`
+	Hooks  hooksConfig  `json:"hooks"`
+}
+
+// configLayer is one place settings can come from.
+type configLayer struct {
+	name    string // shown by nt config show
+	path    string // "" for the built-in defaults
+	profile string // for the profiles file, the profile to read from it
+}
+
+// configLayers lists where a repo's settings come from, lowest precedence first.
+// repoPath may be "" outside a repository, and profile "" for none.
+func configLayers(repoPath, profile string) []configLayer {
+	layers := []configLayer{{name: "default"}}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		layers = append(layers, configLayer{
+			name: "~/.nanotown/" + userConfigFile,
+			path: filepath.Join(home, ".nanotown", userConfigFile),
+		})
+	}
+	if repoPath != "" {
+		path := filepath.Join(repoPath, repoConfigFile)
+		layers = append(layers, configLayer{name: path, path: path})
+	}
+	if profile != "" && err == nil {
+		layers = append(layers, configLayer{
+			name:    "profile " + profile,
+			path:    filepath.Join(home, ".nanotown", profilesFile),
+			profile: profile,
+		})
+	}
+	return layers
+}
+
+// configDefaults are the built-in values that have a setting, so nt config show
+// can list them. Other settings default to off.
+func configDefaults() map[string]any {
+	return map[string]any{
+		"stopSequence":    formatStopSequence(defaultStopSequence),
+		"activeThreshold": formatSetting(defaultActiveThreshold),
+		"ports":           defaultPorts,
+		"portRange":       defaultPortRange,
+		"notify": map[string]any{
+			"idleAfter":   formatSetting(defaultNotifyIdleAfter),
+			"minInterval": formatSetting(defaultNotifyMinInterval),
+		},
+		"hooks": map[string]any{
+			"idleAfter": formatSetting(defaultHookIdleAfter),
+		},
+	}
+}
+
+// formatSetting writes a duration the way it would be in a config file:
+// "1m" rather than "1m0s".
+func formatSetting(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// loadRepoConfig returns the effective config for a repo: the built-in
+// defaults, then ~/.nanotown/config, then the repo's file, then the profile
+// if one is given. Missing files are not an error; a missing profile is.
+func loadRepoConfig(repoPath, profile string) (repoConfig, error) {
+	cfg, _, err := loadLayeredConfig(repoPath, profile)
+	return cfg, err
+}
+
+// loadSessionConfig returns the config a session was started with.
+func loadSessionConfig(s *Session) (repoConfig, error) {
+	return loadRepoConfig(s.RepoPath, s.Profile)
+}
+
+// loadLayeredConfig merges the config layers and also returns which layer
+// each setting came from, keyed by its dotted name (e.g. "hooks.on-exit").
+func loadLayeredConfig(repoPath, profile string) (repoConfig, map[string]string, error) {
+	var cfg repoConfig
+	merged := map[string]any{}
+	sources := map[string]string{}
+	for _, layer := range configLayers(repoPath, profile) {
+		values := configDefaults()
+		if layer.path != "" {
+			var err error
+			if values, err = readConfigLayer(layer); err != nil {
+				return cfg, nil, err
+			}
+		}
+		mergeConfig(merged, values, layer.name, "", sources)
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to merge config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, nil, fmt.Errorf("failed to merge config: %w", err)
+	}
+	return cfg, sources, nil
+}
+
+// readConfigLayer reads and checks one config file on its own, so mistakes are
+// reported against the file that has them. A missing file has no settings.
+func readConfigLayer(layer configLayer) (map[string]any, error) {
+	path := layer.path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && layer.profile == "" {
+			return nil, nil
+		}
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown profile %q: there is no %s", layer.profile, path)
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if layer.profile != "" {
+		var profiles map[string]json.RawMessage
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+		if data = profiles[layer.profile]; data == nil {
+			return nil, fmt.Errorf("unknown profile %q: it is not in %s", layer.profile, path)
+		}
+		path = fmt.Sprintf("profile %q in %s", layer.profile, path)
+	}
+	var cfg repoConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// mergeConfig layers src over dst. Objects are merged key by key; anything
+// else, lists included, replaces what was there.
+func mergeConfig(dst, src map[string]any, source, prefix string, sources map[string]string) {
+	for k, v := range src {
+		key := prefix + k
+		if sub, ok := v.(map[string]any); ok {
+			d, ok := dst[k].(map[string]any)
+			if !ok {
+				d = map[string]any{}
+				dst[k] = d
+			}
+			mergeConfig(d, sub, source, key+".", sources)
+			continue
+		}
+		dst[k] = v
+		sources[key] = source
+	}
+}
+
+// validate checks the settings that are parsed later, when a session starts.
+func (c repoConfig) validate() error {
+	if err := c.Include.validate(); err != nil {
+		return err
+	}
+	if _, err := c.limits(); err != nil {
+		return err
+	}
+	if _, _, err := c.timeouts(); err != nil {
+		return err
+	}
+	if c.Restart != "" {
+		if _, err := parseRestartPolicy(c.Restart); err != nil {
+			return err
+		}
+	}
+	if _, err := c.stopSequence(); err != nil {
+		return err
+	}
+	if _, err := c.activeThreshold(); err != nil {
+		return err
+	}
+	if _, err := c.Hooks.idleAfter(); err != nil {
+		return err
+	}
+	if c.Ports < 0 || c.Ports > maxPorts {
+		return fmt.Errorf("invalid ports %d (0 to %d)", c.Ports, maxPorts)
+	}
+	if _, _, err := c.portRange(); err != nil {
+		return err
+	}
+	if _, err := newPromptDetector(c.InputPatterns); err != nil {
+		return err
+	}
+	_, err := newNotifier(c.Notify)
+	return err
+}
+
+// limits returns the default resource limits set in the config.
+func (c repoConfig) limits() (resourceLimits, error) {
+	var l resourceLimits
+	if c.MaxMem != "" {
+		if err := l.set("--max-mem", c.MaxMem); err != nil {
+			return l, fmt.Errorf("maxMem: %w", err)
+		}
+	}
+	if c.MaxProcs != 0 {
+		if err := l.set("--max-procs", fmt.Sprint(c.MaxProcs)); err != nil {
+			return l, fmt.Errorf("maxProcs: %w", err)
+		}
+	}
+	if c.CPUWeight != 0 {
+		if err := l.set("--cpu-weight", fmt.Sprint(c.CPUWeight)); err != nil {
+			return l, fmt.Errorf("cpuWeight: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// timeouts returns the default watchdog timeouts set in the config.
+func (c repoConfig) timeouts() (idle, maxRuntime time.Duration, err error) {
+	if c.IdleTimeout != "" {
+		if idle, err = parseDurationArg(c.IdleTimeout); err != nil || idle <= 0 {
+			return 0, 0, fmt.Errorf("invalid idleTimeout %q (e.g. 30m)", c.IdleTimeout)
+		}
+	}
+	if c.MaxRuntime != "" {
+		if maxRuntime, err = parseDurationArg(c.MaxRuntime); err != nil || maxRuntime <= 0 {
+			return 0, 0, fmt.Errorf("invalid maxRuntime %q (e.g. 4h)", c.MaxRuntime)
+		}
+	}
+	return idle, maxRuntime, nil
+}
+
+// stopSequence returns the configured shutdown steps, or the built-in ones.
+func (c repoConfig) stopSequence() ([]stopStep, error) {
+	if c.StopSequence == "" {
+		return defaultStopSequence, nil
+	}
+	seq, err := parseStopSequence(c.StopSequence)
+	if err != nil {
+		return nil, fmt.Errorf("stopSequence: %w", err)
+	}
+	return seq, nil
+}
+
+// activeThreshold returns how long a quiet session still shows as active.
+func (c repoConfig) activeThreshold() (time.Duration, error) {
+	if c.ActiveThreshold == "" {
+		return defaultActiveThreshold, nil
+	}
+	d, err := parseDurationArg(c.ActiveThreshold)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid activeThreshold %q (e.g. 2s)", c.ActiveThreshold)
+	}
+	return d, nil
+}
+
+// portRange returns where session ports are allocated from.
+func (c repoConfig) portRange() (lo, hi int, err error) {
+	if c.PortRange == "" {
+		return parsePortRange(defaultPortRange)
+	}
+	return parsePortRange(c.PortRange)
+}
+
+// cmdConfig handles `nt config show [-p profile]`: the effective config for
+// the current repo, one setting per line with the layer it came from.
+func cmdConfig(args []string, cwd string) error {
+	if len(args) < 1 || args[0] != "show" {
+		return fmt.Errorf("usage: nt config show [-p <profile>]")
+	}
+	profile := ""
+	if len(args) >= 3 && args[1] == "-p" {
+		profile = args[2]
+	}
+	repoPath := ""
+	if vcs := detectVcs(cwd); vcs != nil {
+		if root, err := vcs.GetRepoRoot(cwd); err == nil {
+			repoPath = root
+		}
+	}
+	cfg, sources, err := loadLayeredConfig(repoPath, profile)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	var values map[string]any
+	json.Unmarshal(data, &values)
+
+	type setting struct{ key, value, source string }
+	var settings []setting
+	var flatten func(prefix string, m map[string]any)
+	flatten = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			if sub, ok := v.(map[string]any); ok {
+				flatten(prefix+k+".", sub)
+				continue
+			}
+			value, ok := v.(string)
+			if !ok {
+				b, _ := json.Marshal(v)
+				value = string(b)
+			}
+			settings = append(settings, setting{prefix + k, value, sources[prefix+k]})
+		}
+	}
+	flatten("", values)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].key < settings[j].key })
+
+	keyWidth, valueWidth := 0, 0
+	for _, s := range settings {
+		keyWidth = max(keyWidth, len(s.key))
+		valueWidth = max(valueWidth, len(s.value))
+	}
+	for _, s := range settings {
+		fmt.Printf("%-*s  %-*s  \033[2m%s\033[0m\n", keyWidth, s.key, valueWidth, s.value, s.source)
+	}
+	if len(settings) > 0 {
+		fmt.Println()
+	}
+	var files []string
+	for _, layer := range configLayers(repoPath, profile)[1:] {
+		files = append(files, layer.name)
+	}
+	fmt.Printf("Read from %s. CLI flags override these per session.\n", strings.Join(files, ", "))
+	return nil
+}
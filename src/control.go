@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Control socket frames. Every message is a 1-byte type followed by a
+// 4-byte big-endian payload length and the payload itself.
+const (
+	frameAttach byte = 1 // client -> bridge: become the attached client
+	frameData   byte = 2 // input (client -> bridge) or output (bridge -> client)
+	frameDetach byte = 3 // client -> bridge: disconnect the attached client
+	frameInput  byte = 4 // client -> bridge: one-shot input from `nt send`
+	frameWatch  byte = 5 // client -> bridge: receive output read-only
+	frameResize byte = 6 // client -> bridge: window size, 2-byte cols then 2-byte rows
+	frameStop   byte = 7 // client -> bridge: exit reason, sent by nt stop before it signals
+)
+
+const maxFrameSize = 1 << 20
+
+// Recent output replayed to clients when they connect, so they don't start on a blank screen
+const scrollbackSize = 64 << 10
+
+// A client that can't take output within this long is dropped rather than stalling the session
+const clientWriteTimeout = 2 * time.Second
+
+// writeFrame sends a frame in a single Write so concurrent writers on the
+// same connection can't interleave.
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	header := make([]byte, 5)
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("control frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// listen opens the session's control socket, which is how other nt processes
+// (attach, detach, send) reach a running session.
+func (b *PtyBridge) listen(path string) error {
+	os.Remove(path) // stale socket from a session that didn't shut down cleanly
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to open control socket: %w", err)
+	}
+	b.listener = l
+	b.socketPath = path
+	b.scrollback = newTailBuffer(scrollbackSize)
+	b.watchers = map[net.Conn]bool{}
+	b.launched = make(chan struct{})
+	go b.serve()
+	return nil
+}
+
+// startInput lets input from control clients through to the PTY. Until the
+// session has launched there's no PTY to write to, so `nt send` and attached
+// clients wait (setup and the on-start hook can take a while).
+func (b *PtyBridge) startInput() {
+	if b.launched != nil {
+		close(b.launched)
+	}
+}
+
+func (b *PtyBridge) writeInput(p []byte) {
+	<-b.launched
+	b.ptyWriter.Write(p)
+	b.inputReceived()
+}
+
+func (b *PtyBridge) closeControl() {
+	if b.listener == nil {
+		return
+	}
+	b.listener.Close()
+	os.Remove(b.socketPath)
+	b.setClient(nil)
+	b.clientMu.Lock()
+	for w := range b.watchers {
+		w.Close()
+		delete(b.watchers, w)
+	}
+	b.clientMu.Unlock()
+}
+
+func (b *PtyBridge) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handleConn(conn)
+	}
+}
+
+// handleConn dispatches on the first frame a connection sends.
+func (b *PtyBridge) handleConn(conn net.Conn) {
+	typ, payload, err := readFrame(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	switch typ {
+	case frameInput:
+		b.writeInput(payload)
+		conn.Close()
+	case frameAttach:
+		if !b.detached {
+			conn.Close() // foreground sessions are already attached to their own terminal
+			return
+		}
+		// A new attach takes over from any existing client, like reattaching a tmux session elsewhere
+		b.setClient(conn)
+		for {
+			typ, payload, err := readFrame(conn)
+			if err != nil {
+				break
+			}
+			switch typ {
+			case frameData:
+				b.writeInput(payload)
+			case frameResize:
+				// Only the attached client drives the size; watchers see whatever it renders
+				if cols, rows, ok := decodeSize(payload); ok {
+					b.Resize(cols, rows)
+				}
+			}
+		}
+		b.clearClient(conn)
+	case frameDetach:
+		b.setClient(nil)
+		conn.Close()
+	case frameStop:
+		b.stopMu.Lock()
+		b.stopReason = string(payload)
+		b.stopMu.Unlock()
+		conn.Close()
+	case frameWatch:
+		b.addWatcher(conn)
+		// Watchers never send input; block until they hang up
+		for {
+			if _, _, err := readFrame(conn); err != nil {
+				break
+			}
+		}
+		b.removeWatcher(conn)
+	default:
+		conn.Close()
+	}
+}
+
+// setClient replaces the attached client, disconnecting the previous one,
+// and replays recent output to the new client.
+func (b *PtyBridge) setClient(conn net.Conn) {
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+	if b.client != nil && b.client != conn {
+		b.client.Close()
+	}
+	b.client = conn
+	if conn != nil && !sendToClient(conn, b.scrollback.Bytes()) {
+		b.client = nil
+	}
+}
+
+func (b *PtyBridge) addWatcher(conn net.Conn) {
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+	if sendToClient(conn, b.scrollback.Bytes()) {
+		b.watchers[conn] = true
+	}
+}
+
+func (b *PtyBridge) removeWatcher(conn net.Conn) {
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+	delete(b.watchers, conn)
+	conn.Close()
+}
+
+// clearClient detaches conn if it is still the attached client.
+func (b *PtyBridge) clearClient(conn net.Conn) {
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+	if b.client == conn {
+		b.client = nil
+	}
+	conn.Close()
+}
+
+// writeOutput fans PTY output out to the local terminal (foreground sessions),
+// the attached client (detached sessions) and any watchers. Output nobody is
+// around to see only lands in the scrollback.
+func (b *PtyBridge) writeOutput(p []byte) {
+	if b.out != nil {
+		b.out.Write(p)
+	}
+	b.writeClients(p)
+}
+
+// writeClients sends output to the control clients and scrollback only.
+func (b *PtyBridge) writeClients(p []byte) {
+	if b.listener == nil {
+		return
+	}
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+	b.scrollback.Write(p)
+	if b.client != nil && !sendToClient(b.client, p) {
+		b.client = nil
+	}
+	for w := range b.watchers {
+		if !sendToClient(w, p) {
+			delete(b.watchers, w)
+		}
+	}
+}
+
+// writeNotice shows one of nanotown's own messages in the session, and
+// records it in the log and recording like the session's output. Headless
+// sessions print it to stderr instead, so it doesn't end up in the command's
+// piped output.
+func (b *PtyBridge) writeNotice(msg string) {
+	line := []byte("\r\n\033[33m[nt] " + msg + "\033[0m\r\n")
+	if b.headless {
+		fmt.Fprintf(os.Stderr, "[nt] %s\n", msg)
+		b.writeClients(line)
+	} else {
+		b.writeOutput(line)
+	}
+	if b.log != nil {
+		b.log.Write(line) // best-effort
+	}
+	if b.cast != nil {
+		b.cast.Output(line)
+	}
+}
+
+// writeTerminal sends escape sequences meant for the user's terminal (bell,
+// desktop notifications) to whoever is looking at the session, without
+// recording them as session output. Headless output is plain text, so it
+// gets nothing.
+func (b *PtyBridge) writeTerminal(p []byte) {
+	if b.out != nil && !b.headless {
+		b.out.Write(p)
+	}
+	if b.listener == nil {
+		return
+	}
+	b.clientMu.Lock()
+	defer b.clientMu.Unlock()
+	if b.client != nil && !sendToClient(b.client, p) {
+		b.client = nil
+	}
+	for w := range b.watchers {
+		if !sendToClient(w, p) {
+			delete(b.watchers, w)
+		}
+	}
+}
+
+// sendToClient writes output to a control client, closing it on failure.
+// Returns false if the client was dropped.
+func sendToClient(conn net.Conn, p []byte) bool {
+	if len(p) == 0 {
+		return true
+	}
+	conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+	if err := writeFrame(conn, frameData, p); err != nil {
+		conn.Close()
+		return false
+	}
+	return true
+}
+
+func encodeSize(cols, rows int) []byte {
+	p := make([]byte, 4)
+	binary.BigEndian.PutUint16(p[0:], uint16(cols))
+	binary.BigEndian.PutUint16(p[2:], uint16(rows))
+	return p
+}
+
+func decodeSize(p []byte) (cols, rows int, ok bool) {
+	if len(p) != 4 {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(p[0:])), int(binary.BigEndian.Uint16(p[2:])), true
+}
+
+// dialSession connects to a running session's control socket.
+func dialSession(id string, sm *SessionManager) (net.Conn, error) {
+	s, err := sm.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Alive || !isProcessAlive(s.PID) {
+		return nil, fmt.Errorf("session %s is not running", id)
+	}
+	conn, err := net.Dial("unix", sm.SocketPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session %s: %w", id, err)
+	}
+	return conn, nil
+}
+
+// notifyStop tells a running session why it's about to be ended, so it can
+// record the reason alongside its exit status. Best-effort: sessions without a
+// control socket just record a plain exit.
+func notifyStop(id string, reason string, sm *SessionManager) {
+	conn, err := dialSession(id, sm)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	writeFrame(conn, frameStop, []byte(reason))
+}
+
+// resolveRunningSession maps a session ID or worktree ID to a single running
+// session ID. A worktree must have exactly one running session.
+func resolveRunningSession(target string, sm *SessionManager) (string, error) {
+	sessions := sm.ListAll()
+	for _, s := range sessions {
+		if s.ID == target {
+			return s.ID, nil
+		}
+	}
+	var running []string
+	found := false
+	for _, s := range sessions {
+		if resolveWorktreeID(s) != target {
+			continue
+		}
+		found = true
+		if s.Alive && isProcessAlive(s.PID) {
+			running = append(running, s.ID)
+		}
+	}
+	switch {
+	case !found:
+		return "", fmt.Errorf("no session or worktree found: %s", target)
+	case len(running) == 0:
+		return "", fmt.Errorf("no running sessions on worktree %s", target)
+	case len(running) > 1:
+		return "", fmt.Errorf("worktree %s has %d running sessions (%s); pass a session ID instead", target, len(running), strings.Join(running, ", "))
+	}
+	return running[0], nil
+}
+
+func cmdSend(args []string, sm *SessionManager) error {
+	enter := false
+	var rest []string
+	for _, a := range args {
+		if a == "--enter" {
+			enter = true
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("usage: nt send <session-id|worktree-id> <text> [--enter]")
+	}
+	id, err := resolveRunningSession(rest[0], sm)
+	if err != nil {
+		return err
+	}
+	text := strings.Join(rest[1:], " ")
+	if enter {
+		text += "\r" // what the Enter key sends to a terminal
+	}
+	if len(text) > maxFrameSize {
+		return fmt.Errorf("input too large: %d bytes", len(text))
+	}
+
+	return sendInput(id, text, sm)
+}
+
+// sendInput types text into a running session's PTY.
+func sendInput(id string, text string, sm *SessionManager) error {
+	conn, err := dialSession(id, sm)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, frameInput, []byte(text)); err != nil {
+		return fmt.Errorf("failed to send input to session %s: %w", id, err)
+	}
+	return nil
+}
+
+// tailBuffer keeps the last size bytes written to it.
+type tailBuffer struct {
+	buf  []byte
+	size int
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+func (r *tailBuffer) Write(p []byte) {
+	if len(p) >= r.size {
+		r.buf = append(r.buf[:0], p[len(p)-r.size:]...)
+		return
+	}
+	if overflow := len(r.buf) + len(p) - r.size; overflow > 0 {
+		r.buf = append(r.buf[:0], r.buf[overflow:]...)
+	}
+	r.buf = append(r.buf, p...)
+}
+
+func (r *tailBuffer) Bytes() []byte {
+	return r.buf
+}
@@ -3,29 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"strconv"
 )
 
 const worktreeDir = ".nanotown"
 
 type GitBackend struct{}
 
-func (g *GitBackend) Detect(path string) bool {
-	current := path
-	for {
-		gitPath := filepath.Join(current, ".git")
-		// .git is a directory in normal repos, but a file in git worktrees
-		_, err := os.Stat(gitPath)
-		if err == nil {
-			return true
-		}
-		parent := filepath.Dir(current)
-		if parent == current {
-			break
-		}
-		current = parent
-	}
-	return false
+func (g *GitBackend) Detect(path string) string {
+	// .git is a directory in normal repos, but a file in git worktrees
+	return findMarker(path, ".git")
 }
 
 func (g *GitBackend) GetRepoRoot(cwd string) (string, error) {
@@ -44,17 +31,16 @@ func (g *GitBackend) GetCurrentBranch(repoPath string) (string, error) {
 	return result, nil
 }
 
-func (g *GitBackend) CreateWorkingCopy(repoPath string, worktreeID string) (string, error) {
-	wtPath := filepath.Join(repoPath, worktreeDir, worktreeID)
+func (g *GitBackend) CreateWorkingCopy(repoPath string, worktreeID string, wtPath string) error {
 	// Try creating with a new branch first; if the branch already exists, reuse it
 	_, err := runCommand(repoPath, "git", "worktree", "add", wtPath, "-b", worktreeID)
 	if err != nil {
 		_, err = runCommand(repoPath, "git", "worktree", "add", wtPath, worktreeID)
 		if err != nil {
-			return "", fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+			return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
 		}
 	}
-	return wtPath, nil
+	return nil
 }
 
 // BranchExists checks if a git branch exists.
@@ -77,8 +63,7 @@ func (g *GitBackend) Merge(repoPath string, sourceBranch string, branch string)
 	return true
 }
 
-func (g *GitBackend) RemoveWorkingCopy(repoPath string, worktreeID string) {
-	wtPath := filepath.Join(repoPath, worktreeDir, worktreeID)
+func (g *GitBackend) RemoveWorkingCopy(repoPath string, worktreeID string, wtPath string) {
 	runCommand(repoPath, "git", "worktree", "remove", "--force", wtPath)
 	if _, err := os.Stat(wtPath); err == nil {
 		os.RemoveAll(wtPath) // fallback if git worktree remove fails (e.g., corrupted metadata)
@@ -86,3 +71,15 @@ func (g *GitBackend) RemoveWorkingCopy(repoPath string, worktreeID string) {
 	// Delete the branch too — nanotown creates one branch per worktree with the same name
 	runCommand(repoPath, "git", "branch", "-D", worktreeID)
 }
+
+func (g *GitBackend) Status(path string) (string, error) {
+	return runCommand(path, "git", "status", "--porcelain")
+}
+
+func (g *GitBackend) CommitsAhead(repoPath string, base string, branch string) (int, error) {
+	revs, err := runCommand(repoPath, "git", "rev-list", "--count", base+".."+branch)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(revs)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HgBackend gives each worktree its own `hg share` of the repo, with a
+// bookmark named after the worktree standing in for git's branch. Shares are
+// made with -B so the bookmarks are visible from the main checkout.
+type HgBackend struct{}
+
+// hg runs an hg command like runCommand, with HGPLAIN set so the output
+// doesn't depend on the user's config, and without prompts.
+func hg(dir string, args ...string) (string, error) {
+	cmd := exec.Command("hg", append([]string{"--config", "ui.interactive=no"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	output, err := cmd.CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err != nil {
+		return "", fmt.Errorf("command failed: hg %s\n%s", strings.Join(args, " "), result)
+	}
+	return result, nil
+}
+
+// hgSymbol quotes a bookmark or branch name for use in a revset.
+func hgSymbol(name string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "'"
+}
+
+func (h *HgBackend) Detect(path string) string {
+	return findMarker(path, ".hg")
+}
+
+func (h *HgBackend) GetRepoRoot(cwd string) (string, error) {
+	result, err := hg(cwd, "root")
+	if err != nil {
+		return "", fmt.Errorf("failed to get repo root: %w", err)
+	}
+	return result, nil
+}
+
+// GetCurrentBranch returns the active bookmark, or the named branch when no
+// bookmark is active.
+func (h *HgBackend) GetCurrentBranch(repoPath string) (string, error) {
+	node, err := hg(repoPath, "log", "-r", ".", "-T", "{node}")
+	if err != nil || strings.Trim(node, "0") == "" {
+		return "", fmt.Errorf("this repository has no commits yet — make an initial commit before using nanotown")
+	}
+	if bookmark, err := hg(repoPath, "log", "-r", ".", "-T", "{activebookmark}"); err == nil && bookmark != "" {
+		return bookmark, nil
+	}
+	return hg(repoPath, "branch")
+}
+
+func (h *HgBackend) CreateWorkingCopy(repoPath string, worktreeID string, wtPath string) error {
+	// Start from the revision the main checkout is on, not the tip of default
+	rev, err := hg(repoPath, "log", "-r", ".", "-T", "{node}")
+	if err != nil {
+		return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+	}
+	reuse := h.BranchExists(repoPath, worktreeID)
+	if reuse {
+		rev = worktreeID
+	}
+	os.MkdirAll(filepath.Dir(wtPath), 0755)
+	if _, err := hg(repoPath, "--config", "extensions.share=", "share", "-B", "-U", repoPath, wtPath); err != nil {
+		return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+	}
+	// Updating to a bookmark by name activates it
+	if _, err := hg(wtPath, "update", rev); err != nil {
+		os.RemoveAll(wtPath)
+		return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+	}
+	if !reuse {
+		// Activate a new bookmark, so commits in the worktree move it along
+		if _, err := hg(wtPath, "bookmark", worktreeID); err != nil {
+			os.RemoveAll(wtPath)
+			return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+		}
+	}
+	return nil
+}
+
+// BranchExists checks if a bookmark exists.
+func (h *HgBackend) BranchExists(repoPath string, branch string) bool {
+	out, err := hg(repoPath, "bookmarks", "-T", "{bookmark}\n")
+	if err != nil {
+		return false
+	}
+	for _, name := range strings.Split(out, "\n") {
+		if name == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceRev is the revset for the branch the main checkout merges into. A
+// named branch can have several heads, the worktree's among them, so it
+// means the checkout's own revision rather than the branch tip.
+func (h *HgBackend) sourceRev(repoPath string, sourceBranch string) string {
+	if h.BranchExists(repoPath, sourceBranch) {
+		return hgSymbol(sourceBranch)
+	}
+	return "."
+}
+
+// Merge brings the worktree's bookmark into sourceBranch: a fast-forward
+// when sourceBranch hasn't moved since, otherwise hg merge and a merge commit.
+func (h *HgBackend) Merge(repoPath string, sourceBranch string, branch string) bool {
+	source := h.sourceRev(repoPath, sourceBranch)
+	sourceNode, err := hg(repoPath, "log", "-r", source, "-T", "{node}")
+	if err == nil {
+		var base string
+		base, err = hg(repoPath, "log", "-r", fmt.Sprintf("ancestor(%s, %s)", source, hgSymbol(branch)), "-T", "{node}")
+		if err == nil && base == sourceNode {
+			err = h.fastForward(repoPath, sourceBranch, branch)
+		} else if err == nil {
+			if source != "." {
+				_, err = hg(repoPath, "update", sourceBranch)
+			}
+			if err == nil {
+				_, err = hg(repoPath, "merge", "--tool", ":merge", "-r", hgSymbol(branch))
+			}
+			if err == nil {
+				_, err = hg(repoPath, "commit", "-m", "Merge "+branch)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Merge conflict or failure: %s\n", err)
+		return false
+	}
+	return true
+}
+
+func (h *HgBackend) fastForward(repoPath string, sourceBranch string, branch string) error {
+	if h.BranchExists(repoPath, sourceBranch) {
+		if _, err := hg(repoPath, "bookmark", "-f", "-r", hgSymbol(branch), sourceBranch); err != nil {
+			return err
+		}
+		_, err := hg(repoPath, "update", sourceBranch)
+		return err
+	}
+	// A named branch moves with its commits; update by node so the
+	// worktree's bookmark doesn't become active here
+	node, err := hg(repoPath, "log", "-r", hgSymbol(branch), "-T", "{node}")
+	if err == nil {
+		_, err = hg(repoPath, "update", "-r", node)
+	}
+	return err
+}
+
+func (h *HgBackend) RemoveWorkingCopy(repoPath string, worktreeID string, wtPath string) {
+	// A share is self-contained apart from the store it points at
+	os.RemoveAll(wtPath)
+	hg(repoPath, "bookmark", "-d", worktreeID)
+}
+
+func (h *HgBackend) Status(path string) (string, error) {
+	// Leave out nanotown's own metadata in the worktree
+	return hg(path, "status", "-X", "path:"+worktreeDir)
+}
+
+func (h *HgBackend) CommitsAhead(repoPath string, base string, branch string) (int, error) {
+	out, err := hg(repoPath, "log", "-r", fmt.Sprintf("only(%s, %s)", hgSymbol(branch), h.sourceRev(repoPath, base)), "-T", "x")
+	if err != nil {
+		return 0, err
+	}
+	return len(out), nil
+}
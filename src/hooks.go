@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Lifecycle points a hook can run at.
+const (
+	hookOnCreate  = "on-create"  // a new worktree was created, before its first session starts
+	hookOnStart   = "on-start"   // a session is about to launch
+	hookOnIdle    = "on-idle"    // a session has printed nothing for idleAfter
+	hookOnExit    = "on-exit"    // a session ended
+	hookPreMerge  = "pre-merge"  // before nt merge; failing aborts the merge
+	hookPostMerge = "post-merge" // after nt merge succeeded
+	hookOnRemove  = "on-remove"  // a worktree is about to be removed
+)
+
+const defaultHookIdleAfter = 60 * time.Second
+
+// hooksConfig is the "hooks" section of the config file: a shell command
+// for each lifecycle point.
+type hooksConfig struct {
+	OnCreate  string `json:"on-create,omitempty"`
+	OnStart   string `json:"on-start,omitempty"`
+	OnIdle    string `json:"on-idle,omitempty"`
+	OnExit    string `json:"on-exit,omitempty"`
+	PreMerge  string `json:"pre-merge,omitempty"`
+	PostMerge string `json:"post-merge,omitempty"`
+	OnRemove  string `json:"on-remove,omitempty"`
+	IdleAfter string `json:"idleAfter,omitempty"` // for on-idle, default 60s
+}
+
+func (h hooksConfig) command(name string) string {
+	switch name {
+	case hookOnCreate:
+		return h.OnCreate
+	case hookOnStart:
+		return h.OnStart
+	case hookOnIdle:
+		return h.OnIdle
+	case hookOnExit:
+		return h.OnExit
+	case hookPreMerge:
+		return h.PreMerge
+	case hookPostMerge:
+		return h.PostMerge
+	case hookOnRemove:
+		return h.OnRemove
+	}
+	return ""
+}
+
+func (h hooksConfig) idleAfter() (time.Duration, error) {
+	if h.IdleAfter == "" {
+		return defaultHookIdleAfter, nil
+	}
+	d, err := parseDurationArg(h.IdleAfter)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid hooks idleAfter %q (e.g. 60s)", h.IdleAfter)
+	}
+	return d, nil
+}
+
+// hookContext is the session and worktree a hook or notification command
+// runs for. Worktree metadata is read up front, since post-merge and
+// on-remove hooks outlive the worktree.
+type hookContext struct {
+	session      string // "" for worktree-level hooks
+	worktreeID   string
+	wtPath       string
+	repoPath     string
+	sourceBranch string
+	desc         string
+	vars         []string // the config's env, KEY=value
+	ports        []int    // the session's reserved ports
+	extra        []string // additional KEY=value pairs
+}
+
+func sessionHookContext(s *Session) hookContext {
+	c := worktreeHookContext(s.RepoPath, resolveWorktreeID(s), s.WorkingCopyPath)
+	c.session = s.ID
+	return c
+}
+
+func worktreeHookContext(repoPath, worktreeID, wtPath string) hookContext {
+	return hookContext{
+		worktreeID:   worktreeID,
+		wtPath:       wtPath,
+		repoPath:     repoPath,
+		sourceBranch: readSourceBranch(wtPath),
+		desc:         readDescription(wtPath),
+	}
+}
+
+func (c hookContext) env() []string {
+	env := append(os.Environ(),
+		"NT_SESSION="+c.session,
+		"NT_WORKTREE="+c.worktreeID,
+		"NT_WORKTREE_PATH="+c.wtPath,
+		"NT_REPO="+c.repoPath,
+		"NT_SOURCE_BRANCH="+c.sourceBranch,
+		"NT_DESCRIPTION="+c.desc,
+	)
+	env = append(env, c.vars...)
+	env = append(env, portEnv(c.ports)...)
+	return append(env, c.extra...)
+}
+
+// configEnv returns the config's env as KEY=value pairs, sorted by key, with
+// $VARS expanded from our own environment.
+func configEnv(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+os.ExpandEnv(vars[k]))
+	}
+	return env
+}
+
+// runHook runs the hook for name, if one is configured, in the worktree (or
+// the repo root once the worktree is gone). Its output goes to out.
+func runHook(hooks hooksConfig, name string, c hookContext, out io.Writer) error {
+	line := hooks.command(name)
+	if line == "" {
+		return nil
+	}
+	fmt.Fprintf(out, "Running %s hook: %s\n", name, line)
+	cmd := shellCommand(line)
+	cmd.Dir = c.wtPath
+	if _, err := os.Stat(c.wtPath); err != nil {
+		cmd.Dir = c.repoPath
+	}
+	cmd.Env = append(c.env(), "NT_HOOK="+name)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+// runSetup runs a new worktree's setup steps in order, stopping at the first
+// one that fails. Output goes to out.
+func runSetup(steps []string, c hookContext, out io.Writer) error {
+	for _, line := range steps {
+		fmt.Fprintf(out, "Running setup: %s\n", line)
+		cmd := shellCommand(line)
+		cmd.Dir = c.wtPath
+		cmd.Env = c.env()
+		cmd.Stdout = out
+		cmd.Stderr = out
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("setup step %q failed: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// runRepoHook runs the hook for name from the repo's config.
+func runRepoHook(name string, c hookContext, out io.Writer) error {
+	cfg, err := loadRepoConfig(c.repoPath, "")
+	if err != nil {
+		return err
+	}
+	c.vars = configEnv(cfg.Env)
+	return runHook(cfg.Hooks, name, c, out)
+}
+
+// warnHook reports a failed hook without stopping what triggered it.
+func warnHook(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+}
+
+// exitHookEnv describes how a session ended, for the on-exit hook.
+func exitHookEnv(s *Session) []string {
+	env := []string{"NT_EXIT_REASON=" + s.ExitReason}
+	if s.ExitCode != nil {
+		env = append(env, "NT_EXIT_CODE="+strconv.Itoa(*s.ExitCode))
+	}
+	return env
+}
+
+// removeWorktree runs the on-remove hook, then removes the worktree and its
+// registry entry. The worktree ID is the last element of wtPath.
+func removeWorktree(vcs VcsBackend, repoPath string, wtPath string) {
+	worktreeID := filepath.Base(wtPath)
+	warnHook(runRepoHook(hookOnRemove, worktreeHookContext(repoPath, worktreeID, wtPath), os.Stdout))
+	vcs.RemoveWorkingCopy(repoPath, worktreeID, wtPath)
+	unregisterWorktree(wtPath)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// includeConfig is the "include" section of the config file: glob patterns,
+// relative to the repo root, for untracked files the main checkout has and a
+// new worktree needs, such as .env files, local certs or node_modules.
+type includeConfig struct {
+	Copy     []string `json:"copy,omitempty"`     // copy-on-write clone where the filesystem supports it, else a plain copy
+	Hardlink []string `json:"hardlink,omitempty"` // same file in both checkouts; falls back to copying across filesystems
+	Symlink  []string `json:"symlink,omitempty"`  // a link to the main checkout's copy
+}
+
+// includeRule is one way of including files, with its patterns.
+type includeRule struct {
+	mode     string
+	patterns []string
+}
+
+func (c includeConfig) rules() []includeRule {
+	return []includeRule{
+		{"copy", c.Copy},
+		{"hardlink", c.Hardlink},
+		{"symlink", c.Symlink},
+	}
+}
+
+func (c includeConfig) validate() error {
+	for _, m := range c.rules() {
+		for _, pattern := range m.patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil || filepath.IsAbs(pattern) ||
+				strings.HasPrefix(filepath.Clean(pattern), "..") {
+				return fmt.Errorf("invalid include pattern %q (a glob relative to the repo root)", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// includeFiles brings the files matching the include patterns from the main
+// checkout into a new worktree. Anything the worktree already has, such as
+// tracked files, is left alone. Failures are collected so one bad path
+// doesn't stop the rest.
+func includeFiles(cfg includeConfig, repoPath, wtPath string, out io.Writer) error {
+	var errs []error
+	for _, m := range cfg.rules() {
+		for _, pattern := range m.patterns {
+			matches, _ := filepath.Glob(filepath.Join(repoPath, pattern)) // already validated
+			for _, src := range matches {
+				rel, err := filepath.Rel(repoPath, src)
+				if err != nil || isNanotownPath(rel) {
+					continue
+				}
+				dst := filepath.Join(wtPath, rel)
+				if _, err := os.Lstat(dst); err == nil {
+					continue
+				}
+				fmt.Fprintf(out, "Including %s (%s)\n", rel, m.mode)
+				if err := includePath(m.mode, src, dst); err != nil {
+					errs = append(errs, fmt.Errorf("failed to include %s: %w", rel, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isNanotownPath reports whether a repo-relative path is one nanotown or the
+// VCS manages itself, which must never be copied into a worktree.
+func isNanotownPath(rel string) bool {
+	first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return first == worktreeDir || first == ".git" || first == ".hg" || first == ".jj"
+}
+
+func includePath(mode, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if mode == "symlink" {
+		return os.Symlink(src, dst)
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil // sockets, devices and the like
+		}
+		if mode == "hardlink" {
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+// copyFile clones src to dst where the filesystem supports copy-on-write, so
+// large trees cost next to nothing, and copies the bytes otherwise.
+func copyFile(src, dst string, perm os.FileMode) error {
+	if cloneFile(src, dst) == nil {
+		return os.Chmod(dst, perm)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// JjBackend gives each worktree its own `jj workspace`, named after the
+// worktree, with a bookmark of the same name standing in for git's branch.
+// jj doesn't move bookmarks as commits are made, so the bookmark is brought
+// up to the workspace's latest change before anything reads it. It comes
+// before git in vcsBackends, so colocated repos use it.
+type JjBackend struct{}
+
+// jj runs a jj command like runCommand, without a pager or colors.
+func jj(dir string, args ...string) (string, error) {
+	cmd := exec.Command("jj", append([]string{"--no-pager", "--color", "never"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	output, err := cmd.CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err != nil {
+		return "", fmt.Errorf("command failed: jj %s\n%s", strings.Join(args, " "), result)
+	}
+	return result, nil
+}
+
+// jjSymbol quotes a bookmark or workspace name for use in a revset.
+func jjSymbol(name string) string {
+	return strconv.Quote(name)
+}
+
+func (j *JjBackend) Detect(path string) string {
+	return findMarker(path, ".jj")
+}
+
+func (j *JjBackend) GetRepoRoot(cwd string) (string, error) {
+	result, err := jj(cwd, "root")
+	if err != nil {
+		return "", fmt.Errorf("failed to get repo root: %w", err)
+	}
+	return result, nil
+}
+
+// GetCurrentBranch returns the bookmark on the working copy's parent, which
+// is what a merge lands on, leaving out nanotown's own worktree bookmarks.
+// Bookmarks don't follow new commits in jj, so when there isn't one there it
+// returns the parent's change ID instead.
+func (j *JjBackend) GetCurrentBranch(repoPath string) (string, error) {
+	out, err := jj(repoPath, "log", "--no-graph", "-r", "@-",
+		"-T", `local_bookmarks.map(|b| b.name()).join("\n") ++ "\n"`)
+	if err == nil {
+		workspaces := j.workspaces(repoPath)
+		for _, name := range strings.Split(out, "\n") {
+			if name != "" && !workspaces[name] {
+				return name, nil
+			}
+		}
+	}
+	change, err := jj(repoPath, "log", "--no-graph", "-r", "@-", "-T", "change_id.short()")
+	if err != nil || change == "" {
+		return "", fmt.Errorf("failed to find the current change: %w", err)
+	}
+	return change, nil
+}
+
+// workspaces returns the names of the repo's workspaces.
+func (j *JjBackend) workspaces(repoPath string) map[string]bool {
+	names := map[string]bool{}
+	out, err := jj(repoPath, "workspace", "list")
+	if err != nil {
+		return names
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if name, _, ok := strings.Cut(line, ": "); ok {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func (j *JjBackend) CreateWorkingCopy(repoPath string, worktreeID string, wtPath string) error {
+	args := []string{"workspace", "add", "--name", worktreeID}
+	reuse := j.BranchExists(repoPath, worktreeID)
+	if reuse {
+		// Carry on from where the worktree's bookmark left off
+		args = append(args, "-r", jjSymbol(worktreeID))
+	}
+	// Otherwise the new workspace starts on the same parent as ours
+	os.MkdirAll(filepath.Dir(wtPath), 0755)
+	if _, err := jj(repoPath, append(args, wtPath)...); err != nil {
+		return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+	}
+	if !reuse {
+		if _, err := jj(repoPath, "bookmark", "create", worktreeID, "-r", jjSymbol(worktreeID)+"@-"); err != nil {
+			j.RemoveWorkingCopy(repoPath, worktreeID, wtPath)
+			return fmt.Errorf("failed to create worktree %q: %w", worktreeID, err)
+		}
+	}
+	return nil
+}
+
+// BranchExists checks if a bookmark exists.
+func (j *JjBackend) BranchExists(repoPath string, branch string) bool {
+	out, err := jj(repoPath, "log", "--no-graph", "-r", "bookmarks(exact:"+jjSymbol(branch)+")", "-T", `"x"`)
+	return err == nil && out != ""
+}
+
+// syncBookmark moves a worktree's bookmark to the workspace's latest change:
+// the working-copy change if it has any edits, else its parent.
+func (j *JjBackend) syncBookmark(repoPath string, worktreeID string) {
+	if !j.workspaces(repoPath)[worktreeID] {
+		return
+	}
+	head := jjSymbol(worktreeID) + "@"
+	if empty, err := jj(repoPath, "log", "--no-graph", "-r", head, "-T", "empty"); err == nil && empty == "true" {
+		head += "-"
+	}
+	jj(repoPath, "bookmark", "set", worktreeID, "-r", head, "--allow-backwards") // best-effort
+}
+
+// Merge brings the worktree's bookmark into the working copy's parent: a
+// fast-forward when the parent is behind it, otherwise a merge commit, and
+// either way our working copy starts a new change on top. sourceBranch is
+// moved along only if it's a bookmark on the parent, so commits above it that
+// no bookmark points to aren't left out.
+func (j *JjBackend) Merge(repoPath string, sourceBranch string, branch string) bool {
+	j.syncBookmark(repoPath, branch)
+	target := jjSymbol(branch)
+	onParent, err := jj(repoPath, "log", "--no-graph", "-r", "@- & bookmarks(exact:"+jjSymbol(sourceBranch)+")", "-T", `"x"`)
+	moveBookmark := err == nil && onParent != ""
+
+	behind, err := jj(repoPath, "log", "--no-graph", "-r", "@- & ::"+target, "-T", `"x"`)
+	if err == nil && behind != "" {
+		if moveBookmark {
+			_, err = jj(repoPath, "bookmark", "set", sourceBranch, "-r", target)
+		}
+		if err == nil {
+			_, err = jj(repoPath, "new", target)
+		}
+	} else if err == nil {
+		_, err = jj(repoPath, "new", "@-", target, "-m", "Merge "+branch)
+		if err == nil && moveBookmark {
+			_, err = jj(repoPath, "bookmark", "set", sourceBranch, "-r", "@")
+		}
+		if err == nil {
+			_, err = jj(repoPath, "new")
+		}
+		if err == nil {
+			// jj records conflicts in the merge rather than stopping
+			if conflict, _ := jj(repoPath, "log", "--no-graph", "-r", "@-", "-T", "conflict"); conflict == "true" {
+				err = fmt.Errorf("the merge of %s has conflicts; resolve them in the working copy", branch)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Merge conflict or failure: %s\n", err)
+		return false
+	}
+	return true
+}
+
+// MergesWorkingCopy is true: jj snapshots a workspace's edits into its
+// working-copy change, which syncBookmark brings into the merge.
+func (j *JjBackend) MergesWorkingCopy() bool {
+	return true
+}
+
+func (j *JjBackend) RemoveWorkingCopy(repoPath string, worktreeID string, wtPath string) {
+	jj(repoPath, "workspace", "forget", worktreeID)
+	os.RemoveAll(wtPath)
+	jj(repoPath, "bookmark", "delete", worktreeID)
+}
+
+func (j *JjBackend) Status(path string) (string, error) {
+	return jj(path, "diff", "--summary")
+}
+
+func (j *JjBackend) CommitsAhead(repoPath string, base string, branch string) (int, error) {
+	j.syncBookmark(repoPath, branch)
+	out, err := jj(repoPath, "log", "--no-graph", "-r", "::"+jjSymbol(branch)+" ~ ::"+jjSymbol(base), "-T", `"x"`)
+	if err != nil {
+		return 0, err
+	}
+	return len(out), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// resourceLimits caps a session's process tree. Zero means unlimited. The
+// memory and process limits need a cgroup (a job object on Windows) and are
+// refused without one: setrlimit's closest equivalents cap virtual address
+// space, which runtimes like V8 reserve far more of than they use, and count
+// all of the user's processes rather than the session's.
+type resourceLimits struct {
+	MaxMem    int64 `json:"maxMem,omitempty"`    // bytes
+	MaxProcs  int   `json:"maxProcs,omitempty"`  // processes
+	CPUWeight int   `json:"cpuWeight,omitempty"` // 1-10000 on the cgroup v2 cpu.weight scale; 100 is normal
+}
+
+// limiter enforces resource limits on a running session's process tree.
+type limiter interface {
+	add(pid int) error // place the session's process under the limits
+	hit() string       // exit reason for a limit the session ran into, or ""
+	release()          // clean up once the session has exited
+}
+
+func (l resourceLimits) empty() bool {
+	return l == resourceLimits{}
+}
+
+// withDefaults fills in the limits that weren't given from d.
+func (l resourceLimits) withDefaults(d resourceLimits) resourceLimits {
+	if l.MaxMem == 0 {
+		l.MaxMem = d.MaxMem
+	}
+	if l.MaxProcs == 0 {
+		l.MaxProcs = d.MaxProcs
+	}
+	if l.CPUWeight == 0 {
+		l.CPUWeight = d.CPUWeight
+	}
+	return l
+}
+
+func (l resourceLimits) String() string {
+	var parts []string
+	if l.MaxMem > 0 {
+		parts = append(parts, "mem "+formatBytes(l.MaxMem))
+	}
+	if l.MaxProcs > 0 {
+		parts = append(parts, fmt.Sprintf("procs %d", l.MaxProcs))
+	}
+	if l.CPUWeight > 0 {
+		parts = append(parts, fmt.Sprintf("cpu weight %d", l.CPUWeight))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// args renders the limits as the flags set accepts.
+func (l resourceLimits) args() []string {
+	var args []string
+	if l.MaxMem > 0 {
+		args = append(args, "--max-mem", strconv.FormatInt(l.MaxMem, 10))
+	}
+	if l.MaxProcs > 0 {
+		args = append(args, "--max-procs", strconv.Itoa(l.MaxProcs))
+	}
+	if l.CPUWeight > 0 {
+		args = append(args, "--cpu-weight", strconv.Itoa(l.CPUWeight))
+	}
+	return args
+}
+
+func isLimitFlag(flag string) bool {
+	return flag == "--max-mem" || flag == "--max-procs" || flag == "--cpu-weight"
+}
+
+// set applies one of the limit flags.
+func (l *resourceLimits) set(flag, value string) error {
+	switch flag {
+	case "--max-mem":
+		n, err := parseByteSize(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid --max-mem %q (e.g. 512M or 4G)", value)
+		}
+		l.MaxMem = n
+	case "--max-procs":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid --max-procs %q", value)
+		}
+		l.MaxProcs = n
+	case "--cpu-weight":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 10000 {
+			return fmt.Errorf("invalid --cpu-weight %q (1-10000, default 100)", value)
+		}
+		l.CPUWeight = n
+	default:
+		return fmt.Errorf("unknown limit %s", flag)
+	}
+	return nil
+}
+
+// parseByteSize parses sizes like 512M, 4G or 1.5GB. Bare numbers are bytes.
+func parseByteSize(s string) (int64, error) {
+	upper := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if n := len(upper); n > 0 {
+		switch upper[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			upper = upper[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(upper, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v * float64(mult)), nil
+}
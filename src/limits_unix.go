@@ -0,0 +1,50 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// niceCommand rewrites cmd to run through `nt __nice`, which applies a CPU
+// weight to itself as a nice value and then execs the original command. Used
+// when the weight can't go in a cgroup.
+func niceCommand(cmd *exec.Cmd, weight int) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find nt executable: %w", err)
+	}
+	args := []string{self, "__nice", strconv.Itoa(weight), "--", cmd.Path}
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = self
+	return nil
+}
+
+// cmdNice is the internal `nt __nice <cpu-weight> -- <cmd...>` helper.
+func cmdNice(args []string) error {
+	if len(args) < 3 || args[1] != "--" {
+		return fmt.Errorf("usage: nt __nice <cpu-weight> -- <cmd...>")
+	}
+	var l resourceLimits
+	if err := l.set("--cpu-weight", args[0]); err != nil {
+		return err
+	}
+	command := args[2:]
+	// Raising priority needs privileges, so weights above 100 usually have no effect
+	unix.Setpriority(unix.PRIO_PROCESS, 0, weightToNice(l.CPUWeight)) // best-effort
+	return syscall.Exec(command[0], command, os.Environ())
+}
+
+// weightToNice maps a cgroup cpu.weight to the nice value with roughly the
+// same share of CPU: 100 is nice 0 and each nice step is a factor of 1.25.
+func weightToNice(weight int) int {
+	nice := int(math.Round(-math.Log(float64(weight)/100) / math.Log(1.25)))
+	return max(-20, min(19, nice))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Each session's output log is capped at logMaxBytes; when it fills up it is
+// rotated to <id>.log.1 (replacing any older rotation), so a session never
+// uses more than twice this on disk.
+const logMaxBytes = 8 << 20
+
+// sessionLog is an append-only, size-capped copy of a session's PTY output.
+type sessionLog struct {
+	mu   sync.Mutex // output and nanotown's own notices arrive on different goroutines
+	path string
+	f    *os.File
+	size int64
+}
+
+func openSessionLog(path string) (*sessionLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session log: %w", err)
+	}
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	return &sessionLog{path: path, f: f, size: size}, nil
+}
+
+func (l *sessionLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size+int64(len(p)) > logMaxBytes && l.size > 0 {
+		l.rotate()
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+func (l *sessionLog) rotate() {
+	l.f.Close()
+	os.Rename(l.path, l.path+".1")
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		// Keep writing to a discarded handle rather than crashing the session
+		f, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	}
+	l.f = f
+	l.size = 0
+}
+
+func (l *sessionLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// ansiStripper removes terminal escape sequences and control characters from
+// a byte stream. It keeps state between calls so sequences split across
+// reads are still recognized.
+type ansiStripper struct {
+	state int
+}
+
+const (
+	stripText   = iota
+	stripEscape // saw ESC
+	stripCSI    // inside ESC [ ... final byte
+	stripString // inside OSC/DCS/etc., terminated by BEL or ESC \
+	stripStringEscape
+	stripCharset // ESC ( / ESC ) take one more byte
+)
+
+func (a *ansiStripper) Strip(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	for _, c := range p {
+		switch a.state {
+		case stripText:
+			switch {
+			case c == 0x1B:
+				a.state = stripEscape
+			case c == '\n' || c == '\t':
+				out = append(out, c)
+			case c < 0x20 || c == 0x7F:
+				// drop \r, BEL, backspace and other controls
+			default:
+				out = append(out, c)
+			}
+		case stripEscape:
+			switch c {
+			case '[':
+				a.state = stripCSI
+			case ']', 'P', 'X', '^', '_':
+				a.state = stripString
+			case '(', ')', '*', '+':
+				a.state = stripCharset
+			default:
+				a.state = stripText // two-byte sequence like ESC =
+			}
+		case stripCSI:
+			if c >= 0x40 && c <= 0x7E {
+				a.state = stripText
+			}
+		case stripCharset:
+			a.state = stripText
+		case stripString:
+			if c == 0x07 {
+				a.state = stripText
+			} else if c == 0x1B {
+				a.state = stripStringEscape
+			}
+		case stripStringEscape:
+			if c == '\\' {
+				a.state = stripText
+			} else {
+				a.state = stripString
+			}
+		}
+	}
+	return out
+}
+
+func cmdLogs(args []string, sm *SessionManager) error {
+	id := ""
+	follow := false
+	raw := false
+	for _, a := range args {
+		switch a {
+		case "-f", "--follow":
+			follow = true
+		case "--raw":
+			raw = true
+		default:
+			id = a
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("usage: nt logs <session-id> [-f] [--raw]")
+	}
+	if _, err := sm.Read(id); err != nil {
+		return err
+	}
+
+	path := sm.LogPath(id)
+	var out io.Writer = os.Stdout
+	if !raw {
+		out = &strippingWriter{w: os.Stdout}
+	}
+
+	// Older rotated output first, then the current log
+	if data, err := os.ReadFile(path + ".1"); err == nil {
+		out.Write(data)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if !follow {
+				return fmt.Errorf("no output recorded for session %s", id)
+			}
+		} else {
+			return fmt.Errorf("failed to read session log: %w", err)
+		}
+	}
+	var offset int64
+	if f != nil {
+		offset, _ = io.Copy(out, f)
+		f.Close()
+	}
+	if !follow {
+		return nil
+	}
+	return followLog(id, path, offset, out, sm)
+}
+
+// followLog polls the log for new output until the session exits, reopening
+// it from the start when it has been rotated.
+func followLog(id string, path string, offset int64, out io.Writer, sm *SessionManager) error {
+	exited := false
+	for {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() < offset {
+			offset = 0 // rotated underneath us
+		}
+		if err == nil && info.Size() > offset {
+			if f, err := os.Open(path); err == nil {
+				f.Seek(offset, io.SeekStart)
+				n, _ := io.Copy(out, f)
+				offset += n
+				f.Close()
+			}
+			continue
+		}
+		if exited {
+			return nil
+		}
+		// Take one more pass after the session exits to pick up its final output
+		s, err := sm.Read(id)
+		if err != nil || !s.Alive || !isProcessAlive(s.PID) {
+			exited = true
+			continue
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+type strippingWriter struct {
+	w        io.Writer
+	stripper ansiStripper
+}
+
+func (s *strippingWriter) Write(p []byte) (int, error) {
+	if _, err := s.w.Write(s.stripper.Strip(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -2,22 +2,40 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/term"
 )
 
 func main() {
 	setupConsoleEncoding()
 	if err := run(os.Args[1:]); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 }
 
+// exitCodeError makes nt exit with a headless session's exit code without
+// printing anything, so pipelines can check how the command went.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
 func run(args []string) error {
 	sm, err := NewSessionManager()
 	if err != nil {
@@ -33,26 +51,76 @@ func run(args []string) error {
 		return nil
 	}
 
-	// Check if args start with session flags (-d or -w)
-	if args[0] == "-d" || args[0] == "-w" {
-		worktreeID, desc := parseSessionArgs(args)
-		if worktreeID == "" && desc == "" {
+	// Check if args start with session flags (-d, -w, -p, --detach, a limit, a timeout, --restart or --ports)
+	if args[0] == "-d" || args[0] == "-w" || args[0] == "-p" || args[0] == "--detach" || isLimitFlag(args[0]) ||
+		args[0] == "--idle-timeout" || args[0] == "--max-runtime" || args[0] == "--restart" || args[0] == "--ports" {
+		opts, err := parseSessionArgs(args)
+		if err != nil {
+			return err
+		}
+		if opts.worktreeID == "" && opts.desc == "" {
 			return fmt.Errorf("description is required: nt -d <desc>")
 		}
-		return startSession(sm, cwd, desc, worktreeID)
+		return startSession(sm, cwd, opts)
 	}
 
 	command := args[0]
 	switch command {
 	case "status":
 		return cmdLiveStatus(sm)
+	case "top":
+		return cmdTop(sm)
 	case "stop":
+		rest, seq, err := parseStopFlags(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(rest) < 1 {
+			return fmt.Errorf("usage: nt stop <session-id or worktree-id> [--sequence <steps>]")
+		}
+		return cmdStop(rest[0], sm, cwd, seq)
+	case "restart":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: nt restart <session-id>")
+		}
+		return cmdRestart(args[1], sm)
+	case "attach":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: nt attach <session-id>")
+		}
+		return cmdAttach(args[1], sm)
+	case "detach":
+		target := os.Getenv("NT_SESSION")
+		if len(args) >= 2 {
+			target = args[1]
+		}
+		if target == "" {
+			return fmt.Errorf("usage: nt detach <session-id>")
+		}
+		return cmdDetach(target, sm)
+	case "watch":
 		if len(args) < 2 {
-			return fmt.Errorf("usage: nt stop <session-id or worktree-id>")
+			return fmt.Errorf("usage: nt watch <session-id>")
 		}
-		return cmdStop(args[1], sm, cwd)
+		return cmdWatch(args[1], sm)
+	case "send":
+		return cmdSend(args[1:], sm)
+	case "replay":
+		return cmdReplay(args[1:], sm)
+	case "logs":
+		return cmdLogs(args[1:], sm)
+	case "__supervise":
+		// Internal: runs a detached session's PTY, started by startSession
+		return cmdSupervise(args[1:], sm)
+	case "__nice":
+		// Internal: applies a CPU weight as a nice value and execs the session's shell, started by Launch
+		return cmdNice(args[1:])
 	case "stopall":
-		return cmdStopAll(sm, cwd)
+		_, seq, err := parseStopFlags(args[1:])
+		if err != nil {
+			return err
+		}
+		return cmdStopAll(sm, cwd, seq)
 	case "delete":
 		if len(args) < 2 {
 			return fmt.Errorf("usage: nt delete <worktree-id>")
@@ -67,6 +135,13 @@ func run(args []string) error {
 		return cmdAutoClean(sm)
 	case "deleteall":
 		return cmdDeleteAll(sm, cwd)
+	case "config":
+		return cmdConfig(args[1:], cwd)
+	case "info":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: nt info <session-id>")
+		}
+		return cmdInfo(args[1], sm)
 	case "help":
 		printUsage()
 		return nil
@@ -81,35 +156,121 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "Lifecycle:")
 	fmt.Fprintln(os.Stderr, "  nt -d <desc>                  Launch a new session")
 	fmt.Fprintln(os.Stderr, "  nt -w <worktree-id> [-d desc] Launch a new session with a custom worktree ID")
+	fmt.Fprintln(os.Stderr, "  nt -d <desc> -- <cmd...>      Launch a session running cmd instead of a shell")
+	fmt.Fprintln(os.Stderr, "  nt -d <desc> --detach         Launch a session in the background")
+	fmt.Fprintln(os.Stderr, "  nt -p <profile> -d <desc>     Launch a session with a profile from ~/.nanotown/profiles.json")
+	fmt.Fprintln(os.Stderr, "    --max-mem <size>            Limit the session's memory (e.g. 4G)")
+	fmt.Fprintln(os.Stderr, "    --max-procs <n>             Limit the number of processes the session can run")
+	fmt.Fprintln(os.Stderr, "    --cpu-weight <1-10000>      Share of CPU relative to other processes (default 100)")
+	fmt.Fprintln(os.Stderr, "    --idle-timeout <duration>   Stop the session after this long without output (e.g. 30m)")
+	fmt.Fprintln(os.Stderr, "    --max-runtime <duration>    Stop the session after it has run this long (e.g. 4h)")
+	fmt.Fprintln(os.Stderr, "    --restart on-failure[:N]    Relaunch the session when it exits non-zero (at most N times)")
+	fmt.Fprintln(os.Stderr, "    --ports <n>                 Reserve n free TCP ports as NT_PORT, NT_PORT_1... (default 1)")
+	fmt.Fprintln(os.Stderr, "  nt restart <session-id>       Relaunch a session on its worktree with the same command")
+	fmt.Fprintln(os.Stderr, "  nt attach <session-id>        Attach to a detached session (Ctrl-] to detach)")
+	fmt.Fprintln(os.Stderr, "  nt detach [session-id]        Detach the client attached to a session")
+	fmt.Fprintln(os.Stderr, "  nt send <id> <text> [--enter] Type text into a running session")
+	fmt.Fprintln(os.Stderr, "  nt watch <session-id>         Mirror a running session's output (read-only)")
 	fmt.Fprintln(os.Stderr, "  nt status                     Show all sessions (live-updating)")
+	fmt.Fprintln(os.Stderr, "  nt top                        Show running sessions by CPU and memory usage")
 	fmt.Fprintln(os.Stderr, "  nt merge <worktree-id>        Merge into your current VCS branch and clean up")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Cleanup:")
 	fmt.Fprintln(os.Stderr, "  nt stop <id>                  Stop a session or all sessions on a worktree")
+	fmt.Fprintln(os.Stderr, "    --sequence <steps>          Shutdown steps (default from config, or interrupt:2s,term:3s,kill:2s)")
 	fmt.Fprintln(os.Stderr, "  nt stopall                    Stop all running sessions")
 	fmt.Fprintln(os.Stderr, "  nt clean                      Remove stopped sessions and orphaned worktrees")
 	fmt.Fprintln(os.Stderr, "  nt delete <worktree-id>       Delete a worktree and its sessions")
 	fmt.Fprintln(os.Stderr, "  nt deleteall                  Delete all sessions and worktrees")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Info:")
+	fmt.Fprintln(os.Stderr, "  nt info <session-id>          Show details of a session, including how it ended")
+	fmt.Fprintln(os.Stderr, "  nt logs <id> [-f] [--raw]     Show a session's output (-f to follow)")
+	fmt.Fprintln(os.Stderr, "  nt replay <id> [--speed 2x] [--idle-cap 2s]  Play back a session's recording")
+	fmt.Fprintln(os.Stderr, "  nt config show [-p profile]   Show the effective config and where each setting comes from")
 	fmt.Fprintln(os.Stderr, "  nt help                       Show this help message")
 }
 
 
-func parseSessionArgs(args []string) (worktreeID string, desc string) {
+// sessionOptions are the flags accepted when launching a session.
+type sessionOptions struct {
+	worktreeID string
+	desc       string
+	detach     bool
+	command    []string // run instead of an interactive shell; everything after --
+	limits     resourceLimits
+	idle       time.Duration // --idle-timeout
+	maxRuntime time.Duration // --max-runtime
+	restart    string        // --restart policy
+	ports      int           // --ports; negative when not given
+	profile    string        // -p
+}
+
+func parseSessionArgs(args []string) (sessionOptions, error) {
+	opts := sessionOptions{ports: -1}
 	for i := 0; i < len(args); i++ {
-		if args[i] == "-w" && i+1 < len(args) {
-			worktreeID = args[i+1]
+		if args[i] == "--" {
+			opts.command = args[i+1:]
+			if len(opts.command) == 0 {
+				return opts, fmt.Errorf("missing command after --")
+			}
+			break
+		} else if args[i] == "--detach" {
+			opts.detach = true
+		} else if args[i] == "-w" && i+1 < len(args) {
+			opts.worktreeID = args[i+1]
 			i++
 		} else if args[i] == "-d" && i+1 < len(args) {
-			desc = args[i+1]
+			opts.desc = args[i+1]
+			i++
+		} else if args[i] == "-p" && i+1 < len(args) {
+			opts.profile = args[i+1]
+			i++
+		} else if (args[i] == "--idle-timeout" || args[i] == "--max-runtime") && i+1 < len(args) {
+			d, err := parseDurationArg(args[i+1])
+			if err != nil || d <= 0 {
+				return opts, fmt.Errorf("invalid %s %q (e.g. 30m or 4h)", args[i], args[i+1])
+			}
+			if args[i] == "--idle-timeout" {
+				opts.idle = d
+			} else {
+				opts.maxRuntime = d
+			}
+			i++
+		} else if args[i] == "--restart" && i+1 < len(args) {
+			if _, err := parseRestartPolicy(args[i+1]); err != nil {
+				return opts, err
+			}
+			opts.restart = args[i+1]
+			i++
+		} else if args[i] == "--ports" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 || n > maxPorts {
+				return opts, fmt.Errorf("invalid --ports %q (0 to %d)", args[i+1], maxPorts)
+			}
+			opts.ports = n
+			i++
+		} else if isLimitFlag(args[i]) && i+1 < len(args) {
+			if err := opts.limits.set(args[i], args[i+1]); err != nil {
+				return opts, err
+			}
 			i++
 		}
 	}
-	return
+	return opts, nil
 }
 
-func startSession(sm *SessionManager, cwd string, desc string, worktreeID string) error {
+func startSession(sm *SessionManager, cwd string, opts sessionOptions) error {
+	desc := opts.desc
+	worktreeID := opts.worktreeID
+
+	// Without a terminal, keep stdout for the session's own output
+	headless := !opts.detach && isHeadless()
+	msgOut := os.Stdout
+	if headless {
+		msgOut = os.Stderr
+	}
+
 	vcs := detectVcs(cwd)
 	if vcs == nil {
 		return fmt.Errorf("not inside a version-controlled repository")
@@ -123,6 +284,40 @@ func startSession(sm *SessionManager, cwd string, desc string, worktreeID string
 	if err != nil {
 		return err
 	}
+	cfg, err := loadRepoConfig(repoPath, opts.profile)
+	if err != nil {
+		return err
+	}
+	defaultLimits, err := cfg.limits()
+	if err != nil {
+		return err
+	}
+	limits := opts.limits.withDefaults(defaultLimits)
+	if err := checkLimits(limits); err != nil {
+		return err
+	}
+	idle, maxRuntime, err := cfg.timeouts()
+	if err != nil {
+		return err
+	}
+	if opts.idle > 0 {
+		idle = opts.idle
+	}
+	if opts.maxRuntime > 0 {
+		maxRuntime = opts.maxRuntime
+	}
+	command := opts.command
+	if len(command) == 0 {
+		command = cfg.Command
+	}
+	restart := opts.restart
+	if restart == "" {
+		restart = cfg.Restart
+	}
+	ports := cfg.Ports
+	if opts.ports >= 0 {
+		ports = opts.ports
+	}
 	id := generateID(sm)
 
 	// Default worktree ID to nt-<id>, skipping if branch/dir already exists
@@ -130,8 +325,8 @@ func startSession(sm *SessionManager, cwd string, desc string, worktreeID string
 		n, _ := strconv.Atoi(id)
 		for {
 			candidate := fmt.Sprintf("nt-%d", n)
-			dirExists := false
-			if _, err := os.Stat(filepath.Join(repoPath, ".nanotown", candidate)); err == nil {
+			dirExists := findWorktree(repoPath, candidate) != ""
+			if _, err := os.Stat(filepath.Join(worktreeBase(repoPath, cfg), candidate)); err == nil {
 				dirExists = true
 			}
 			if !dirExists && !vcs.BranchExists(repoPath, candidate) {
@@ -143,12 +338,19 @@ func startSession(sm *SessionManager, cwd string, desc string, worktreeID string
 	}
 
 	// Check if worktree already exists; reuse if so, otherwise create
-	wtPath := filepath.Join(repoPath, ".nanotown", worktreeID)
-	if _, err := os.Stat(wtPath); err == nil {
-		fmt.Printf("Reusing existing worktree: %s\n", worktreeID)
+	wtPath := findWorktree(repoPath, worktreeID)
+	created := false
+	if wtPath != "" {
+		fmt.Fprintf(msgOut, "Reusing existing worktree: %s\n", worktreeID)
 	} else {
-		wtPath, err = vcs.CreateWorkingCopy(repoPath, worktreeID)
-		if err != nil {
+		created = true
+		wtPath = filepath.Join(worktreeBase(repoPath, cfg), worktreeID)
+		if err := vcs.CreateWorkingCopy(repoPath, worktreeID, wtPath); err != nil {
+			return err
+		}
+		if err := registerWorktree(repoPath, worktreeID, wtPath); err != nil {
+			// Unregistered, nothing would ever find it again
+			vcs.RemoveWorkingCopy(repoPath, worktreeID, wtPath)
 			return err
 		}
 	}
@@ -173,10 +375,48 @@ func startSession(sm *SessionManager, cwd string, desc string, worktreeID string
 		StartedAt:       now,
 		LastOutputAt:    now,
 		Worktree:        worktreeID,
+		Detached:        opts.detach,
+		Command:         command,
+		Profile:         opts.profile,
+		Env:             configEnv(cfg.Env),
+	}
+	if !limits.empty() {
+		session.Limits = &limits
+	}
+	if idle > 0 {
+		session.IdleTimeout = idle.String()
+	}
+	if maxRuntime > 0 {
+		session.MaxRuntime = maxRuntime.String()
+	}
+	if restart != "no" {
+		session.Restart = restart
 	}
 	if err := sm.Write(session); err != nil {
 		return err
 	}
+	lo, hi, _ := cfg.portRange() // already validated
+	if err := sm.ReservePorts(session, ports, lo, hi, nil); err != nil {
+		session.Alive = false
+		sm.Write(session) // best-effort
+		return err
+	}
+
+	if created {
+		c := worktreeHookContext(repoPath, worktreeID, wtPath)
+		c.session = id
+		c.vars = session.Env
+		c.ports = session.Ports
+		if err := includeFiles(cfg.Include, repoPath, wtPath, msgOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+		}
+		if err := runSetup(cfg.Setup, c, msgOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s; continuing anyway\n", err)
+		}
+		if err := runHook(cfg.Hooks, hookOnCreate, c, msgOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s; continuing anyway\n", err)
+		}
+	}
 
 	// Expose to scripts/tools running inside the PTY shell
 	os.Setenv("NT_SESSION", id)
@@ -184,51 +424,232 @@ func startSession(sm *SessionManager, cwd string, desc string, worktreeID string
 	defer os.Unsetenv("NT_SESSION")
 	defer os.Unsetenv("NT_BRANCH")
 
-	// Write banner to a temp file so the shell can display it on startup
-	bannerFile := filepath.Join(wtPath, ".nanotown", "banner")
-	os.WriteFile(bannerFile, []byte(formatBanner(id, worktreeID, desc)), 0644)
-	defer os.Remove(bannerFile)
-
-	bridge := &PtyBridge{
-		session:        session,
-		sessionManager: sm,
+	if opts.detach {
+		if err := spawnSupervisor(session); err != nil {
+			session.Alive = false
+			sm.Write(session) // best-effort
+			return err
+		}
+		fmt.Printf("Session %s started in the background on worktree %s.\n", id, worktreeID)
+		fmt.Printf("Attach with: nt attach %s\n", id)
+		return nil
 	}
+	return runWithRestarts(sm, session, desc, func() *PtyBridge {
+		return &PtyBridge{headless: headless}
+	})
+}
+
+// runSession launches the shell for session in a PTY and blocks until it exits.
+// The bridge is either a foreground one or a detached supervisor's.
+func runSession(sm *SessionManager, session *Session, desc string, bridge *PtyBridge) error {
+	id := session.ID
+	worktreeID := resolveWorktreeID(session)
+	wtPath := session.WorkingCopyPath
+
 	title := formatTitle(worktreeID, desc)
-	if err := bridge.Launch(wtPath, bannerFile, title); err != nil {
+	msgOut := os.Stdout
+	bannerFile, launchTitle := "", ""
+	if bridge.headless {
+		// Keep stdout for the session's own output: no banner, title escape or status lines
+		msgOut = os.Stderr
+	} else {
+		// Write banner to a temp file so the shell can display it on startup
+		bannerFile = filepath.Join(wtPath, ".nanotown", "banner")
+		os.WriteFile(bannerFile, []byte(formatBanner(id, worktreeID, desc, session.Command)), 0644)
+		defer os.Remove(bannerFile)
+		launchTitle = title
+	}
+
+	bridge.session = session
+	bridge.sessionManager = sm
+	if !bridge.detached {
+		bridge.cols, bridge.rows = terminalSize()
+	}
+	if log, err := openSessionLog(sm.LogPath(id)); err == nil {
+		bridge.log = log
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s; output will not be recorded\n", err)
+	}
+	if err := bridge.listen(sm.SocketPath(id)); err != nil {
+		if bridge.detached {
+			// A detached session is unreachable without its socket
+			session.Alive = false
+			sm.Write(session) // best-effort; releases its ports
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s; nt send will not reach this session\n", err)
+	}
+	// Re-read for nt restart and detached sessions, so it may have been
+	// edited since startSession validated it
+	cfg, err := loadSessionConfig(session)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s; hooks, needs input detection and notifications are off\n", err)
+		cfg = repoConfig{}
+	}
+	if prompts, err := newPromptDetector(cfg.InputPatterns); err == nil {
+		bridge.prompts = prompts
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s; needs input detection is off\n", err)
+	}
+	bridge.hooks = cfg.Hooks
+	// Inherited by the session and its hooks. The env was resolved when the
+	// session started, so restarts get the same values.
+	for _, kv := range append(session.Env, portEnv(session.Ports)...) {
+		k, v, _ := strings.Cut(kv, "=")
+		os.Setenv(k, v)
+	}
+	if n, err := newNotifier(cfg.Notify); err == nil {
+		bridge.notifier = n
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s; notifications are off\n", err)
+	}
+	if cast, err := openCastRecorder(sm.CastPath(id), bridge.cols, bridge.rows, title); err == nil {
+		bridge.cast = cast
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s; nt replay will not be available\n", err)
+	}
+	warnHook(runHook(cfg.Hooks, hookOnStart, sessionHookContext(session), msgOut))
+	if err := bridge.Launch(wtPath, bannerFile, launchTitle, session.Command); err != nil {
+		bridge.closeControl()
+		session.Alive = false
+		sm.Write(session) // best-effort; releases its ports
 		return fmt.Errorf("failed to launch PTY process: %w", err)
 	}
+	bridge.startInput()
 
 	session.PID = bridge.Pid()
 	if err := sm.Write(session); err != nil {
 		return err
 	}
+	bridge.startWatchdog(session.timeouts())
 
-	bridge.WaitFor()
+	code, signal := bridge.WaitFor()
 
-	session.Alive = false
+	session.LastOutputAt = bridge.LastOutput().UTC().Format(time.RFC3339Nano)
+	os.Remove(sm.ActivityPath(id)) // folded into the session file below
+	os.Remove(sm.PromptPath(id))
+	reason := bridge.StopReason()
+	if reason == "" && code != 0 {
+		reason = bridge.LimitHit()
+	}
+	session.recordExit(code, signal, reason)
 	sm.Write(session) // best-effort
-	fmt.Printf("Session %s exited.\n", id)
+	// Before the control socket closes, so attached clients get it too
+	bridge.notify(notifyExit, exitLabel(session))
+	bridge.closeControl()
+	if label := exitLabel(session); label == "exited 0" {
+		fmt.Fprintf(msgOut, "Session %s exited.\n", id)
+	} else {
+		fmt.Fprintf(msgOut, "Session %s exited (%s).\n", id, label)
+	}
+	exitCtx := sessionHookContext(session)
+	exitCtx.extra = exitHookEnv(session)
+	warnHook(runHook(cfg.Hooks, hookOnExit, exitCtx, msgOut))
+	if bridge.headless && code != 0 {
+		if code < 0 {
+			code = 1
+		}
+		return &exitCodeError{code: code}
+	}
 	return nil
 }
 
+// spawnSupervisor starts `nt __supervise` in the background to own the PTY of
+// a detached session. It inherits NT_SESSION/NT_BRANCH from our environment.
+func spawnSupervisor(session *Session) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate nt executable: %w", err)
+	}
+	// No terminal will be attached at launch, so size the PTY like the one we were started from
+	cols, rows := terminalSize()
+	cmd := exec.Command(exe, "__supervise", session.ID, strconv.Itoa(cols), strconv.Itoa(rows))
+	cmd.Dir = session.WorkingCopyPath
+	cmd.Env = os.Environ()
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start session supervisor: %w", err)
+	}
+	cmd.Process.Release()
+	return nil
+}
+
+// isHeadless reports whether we're running without a terminal on stdin or
+// stdout, e.g. from CI, cron or a pipe.
+func isHeadless() bool {
+	return !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// terminalSize returns the size of our terminal, or 80x24 without one.
+func terminalSize() (cols, rows int) {
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		return w, h
+	}
+	return 80, 24
+}
+
+func cmdSupervise(args []string, sm *SessionManager) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: nt __supervise <session-id> <cols> <rows>")
+	}
+	cols, err := strconv.Atoi(args[1])
+	if err != nil || cols <= 0 {
+		return fmt.Errorf("invalid terminal width %q", args[1])
+	}
+	rows, err := strconv.Atoi(args[2])
+	if err != nil || rows <= 0 {
+		return fmt.Errorf("invalid terminal height %q", args[2])
+	}
+	session, err := sm.Read(args[0])
+	if err != nil {
+		return err
+	}
+	return runWithRestarts(sm, session, readDescription(session.WorkingCopyPath), func() *PtyBridge {
+		return &PtyBridge{detached: true, cols: cols, rows: rows}
+	})
+}
+
 func cmdLiveStatus(sm *SessionManager) error {
+	var sessions []*Session
+	var worktrees []worktreeInfo
+	usage := newUsageSampler()
+	return runLiveView(func() {
+		sessions = sm.ListAll()
+		worktrees = listWorktrees(sessions)
+		refreshSessionInfo(sessions, sm, worktrees, usage)
+	}, func() (string, int) {
+		return renderStatus(sessions, worktrees)
+	})
+}
+
+// cmdTop is a live view of running sessions sorted by CPU and memory usage.
+func cmdTop(sm *SessionManager) error {
+	var sessions []*Session
+	usage := newUsageSampler()
+	return runLiveView(func() {
+		sessions = sm.ListAll()
+		refreshSessionInfo(sessions, sm, nil, usage)
+	}, func() (string, int) {
+		return renderTop(sessions)
+	})
+}
+
+// runLiveView redraws render's output in place until interrupted, calling
+// refresh before the first frame and then about once a second.
+func runLiveView(refresh func(), render func() (string, int)) error {
 	// Hide cursor
 	fmt.Print("\033[?25l")
 	defer fmt.Print("\033[?25h")
 
-	var sessions []*Session
-	var worktrees []worktreeInfo
 	prevLines := 0
 	tick := 0
 	for {
 		// Expensive ops (disk I/O, process scan) every ~1s; display refreshes every 100ms for smooth spinners
 		if tick%10 == 0 {
-			sessions = sm.ListAll()
-			worktrees = listWorktrees(sessions)
-			refreshSessionInfo(sessions, sm, worktrees)
+			refresh()
 		}
 
-		output, lines := renderStatus(sessions, worktrees)
+		output, lines := render()
 
 		// Move cursor up to overwrite previous frame
 		if prevLines > 0 {
@@ -259,22 +680,7 @@ func cmdLiveStatus(sm *SessionManager) error {
 	}
 }
 
-func stopSession(session *Session, sm *SessionManager) {
-	if !session.Alive || !isProcessAlive(session.PID) {
-		return
-	}
-	fmt.Printf("Stopping session %s (pid %d)...\n", session.ID, session.PID)
-	killProcess(session.PID)
-	time.Sleep(3 * time.Second)
-	if isProcessAlive(session.PID) {
-		fmt.Println("Process still alive, force killing...")
-		forceKillProcess(session.PID)
-	}
-	session.Alive = false
-	sm.Write(session) // best-effort
-}
-
-func cmdStop(target string, sm *SessionManager, cwd string) error {
+func cmdStop(target string, sm *SessionManager, cwd string, seq []stopStep) error {
 	// Try matching as a session ID first
 	sessions := sm.ListAll()
 	for _, s := range sessions {
@@ -283,7 +689,7 @@ func cmdStop(target string, sm *SessionManager, cwd string) error {
 				fmt.Fprintf(os.Stderr, "Session %s is not running.\n", target)
 				return nil
 			}
-			stopSession(s, sm)
+			stopSession(s, sm, seq)
 			fmt.Printf("Stopped session %s.\n", target)
 			return nil
 		}
@@ -294,7 +700,7 @@ func cmdStop(target string, sm *SessionManager, cwd string) error {
 	for _, s := range sessions {
 		wt := resolveWorktreeID(s)
 		if wt == target && s.Alive && isProcessAlive(s.PID) {
-			stopSession(s, sm)
+			stopSession(s, sm, seq)
 			stopped++
 		}
 	}
@@ -303,8 +709,7 @@ func cmdStop(target string, sm *SessionManager, cwd string) error {
 		if vcs != nil {
 			repoPath, _ := vcs.GetRepoRoot(cwd)
 			if repoPath != "" {
-				wtPath := filepath.Join(repoPath, ".nanotown", target)
-				if _, err := os.Stat(wtPath); err != nil {
+				if findWorktree(repoPath, target) == "" {
 					return fmt.Errorf("no session or worktree found: %s", target)
 				}
 			}
@@ -326,8 +731,8 @@ func cmdRm(worktreeID string, sm *SessionManager, cwd string) error {
 		return err
 	}
 
-	wtPath := filepath.Join(repoPath, ".nanotown", worktreeID)
-	if _, err := os.Stat(wtPath); err != nil {
+	wtPath := findWorktree(repoPath, worktreeID)
+	if wtPath == "" {
 		return fmt.Errorf("worktree not found: %s", worktreeID)
 	}
 
@@ -335,12 +740,12 @@ func cmdRm(worktreeID string, sm *SessionManager, cwd string) error {
 	for _, s := range sm.ListAll() {
 		wt := resolveWorktreeID(s)
 		if wt == worktreeID {
-			stopSession(s, sm)
+			stopSession(s, sm, nil)
 			sm.Delete(s.ID)
 		}
 	}
 
-	vcs.RemoveWorkingCopy(repoPath, worktreeID)
+	removeWorktree(vcs, repoPath, wtPath)
 	fmt.Printf("Worktree %s deleted.\n", worktreeID)
 	return nil
 }
@@ -356,7 +761,7 @@ func cmdMerge(target string, sm *SessionManager, cwd string) error {
 	}
 
 	// Check for clean working directory
-	status, err := runCommand(repoPath, "git", "status", "--porcelain")
+	status, err := vcs.Status(repoPath)
 	if err == nil && status != "" {
 		return fmt.Errorf("working directory is not clean. Commit or stash your changes first")
 	}
@@ -365,7 +770,12 @@ func cmdMerge(target string, sm *SessionManager, cwd string) error {
 	if err != nil {
 		return err
 	}
-	wtPath := filepath.Join(repoPath, ".nanotown", target)
+	wtPath := findWorktree(repoPath, target)
+	if wtPath == "" {
+		// The worktree may be gone while its branch is still there to merge
+		cfg, _ := loadRepoConfig(repoPath, "")
+		wtPath = filepath.Join(worktreeBase(repoPath, cfg), target)
+	}
 
 	// Check if any running sessions use this worktree
 	for _, s := range sm.ListAll() {
@@ -397,11 +807,15 @@ func cmdMerge(target string, sm *SessionManager, cwd string) error {
 		}
 	}
 
-	if !confirmMerge(wtPath, currentBranch, target) {
+	if !confirmMerge(vcs, repoPath, wtPath, currentBranch, target) {
 		return nil
 	}
+	hookCtx := worktreeHookContext(repoPath, target, wtPath)
+	if err := runRepoHook(hookPreMerge, hookCtx, os.Stdout); err != nil {
+		return fmt.Errorf("%w; merge aborted", err)
+	}
 	if vcs.Merge(repoPath, currentBranch, target) {
-		vcs.RemoveWorkingCopy(repoPath, target)
+		removeWorktree(vcs, repoPath, wtPath)
 		// Clean up any sessions that used this worktree
 		for _, s := range sm.ListAll() {
 			wt := resolveWorktreeID(s)
@@ -410,6 +824,9 @@ func cmdMerge(target string, sm *SessionManager, cwd string) error {
 			}
 		}
 		fmt.Printf("Merged worktree %s into %s and cleaned up.\n", target, currentBranch)
+		if err := runRepoHook(hookPostMerge, hookCtx, os.Stdout); err != nil {
+			return err
+		}
 	} else {
 		fmt.Fprintf(os.Stderr, "Merge conflict. Resolve conflicts in the repo, then run: nt merge %s again\n", target)
 	}
@@ -418,10 +835,11 @@ func cmdMerge(target string, sm *SessionManager, cwd string) error {
 
 // confirmMerge checks for uncommitted changes and no-op merges.
 // Returns true if the merge should proceed.
-func confirmMerge(wtPath string, sourceBranch string, branch string) bool {
-	// Check if worktree has uncommitted changes
-	if _, err := os.Stat(wtPath); err == nil {
-		status, err := runCommand(wtPath, "git", "status", "--porcelain")
+func confirmMerge(vcs VcsBackend, repoPath string, wtPath string, sourceBranch string, branch string) bool {
+	// Check if worktree has uncommitted changes that the merge would leave behind
+	m, ok := vcs.(workingCopyMerger)
+	if _, err := os.Stat(wtPath); err == nil && !(ok && m.MergesWorkingCopy()) {
+		status, err := vcs.Status(wtPath)
 		if err == nil && status != "" {
 			fmt.Printf("Warning: worktree %s has uncommitted changes:\n%s\n", branch, status)
 			fmt.Print("Merge anyway? Uncommitted changes will be lost. [y/N] ")
@@ -438,8 +856,8 @@ func confirmMerge(wtPath string, sourceBranch string, branch string) bool {
 	}
 
 	// Check if there are any commits to merge
-	revs, err := runCommand(wtPath, "git", "rev-list", "--count", sourceBranch+".."+branch)
-	if err == nil && strings.TrimSpace(revs) == "0" {
+	revs, err := vcs.CommitsAhead(repoPath, sourceBranch, branch)
+	if err == nil && revs == 0 {
 		fmt.Printf("Nothing to merge — %s has no new commits vs %s.\n", branch, sourceBranch)
 		return false
 	}
@@ -447,7 +865,7 @@ func confirmMerge(wtPath string, sourceBranch string, branch string) bool {
 	return true
 }
 
-func cmdStopAll(sm *SessionManager, cwd string) error {
+func cmdStopAll(sm *SessionManager, cwd string, seq []stopStep) error {
 	vcs := detectVcs(cwd)
 	if vcs == nil {
 		return fmt.Errorf("not inside a version-controlled repository")
@@ -461,7 +879,7 @@ func cmdStopAll(sm *SessionManager, cwd string) error {
 	stopped := 0
 	for _, s := range sessions {
 		if s.Alive && isProcessAlive(s.PID) {
-			stopSession(s, sm)
+			stopSession(s, sm, seq)
 			stopped++
 		}
 	}
@@ -486,9 +904,10 @@ func cmdAutoClean(sm *SessionManager) error {
 		}
 
 		// Check if worktree has uncommitted changes
-		if s.WorkingCopyPath != "" {
+		vcs := detectVcs(s.RepoPath)
+		if s.WorkingCopyPath != "" && vcs != nil {
 			if _, err := os.Stat(s.WorkingCopyPath); err == nil {
-				status, err := runCommand(s.WorkingCopyPath, "git", "status", "--porcelain")
+				status, err := vcs.Status(s.WorkingCopyPath)
 				if err == nil && status != "" {
 					fmt.Printf("Skipping session %s — worktree has uncommitted changes\n", s.ID)
 					skipped++
@@ -511,9 +930,12 @@ func cmdAutoClean(sm *SessionManager) error {
 			}
 		}
 
-		vcs := detectVcs(s.RepoPath)
 		if vcs != nil && !otherUsing {
-			vcs.RemoveWorkingCopy(s.RepoPath, wt)
+			wtPath := s.WorkingCopyPath
+			if wtPath == "" {
+				wtPath = filepath.Join(s.RepoPath, worktreeDir, wt)
+			}
+			removeWorktree(vcs, s.RepoPath, wtPath)
 		}
 		sm.Delete(s.ID)
 		fmt.Printf("Cleaned session %s\n", s.ID)
@@ -526,8 +948,7 @@ func cmdAutoClean(sm *SessionManager) error {
 	referenced := map[string]bool{}
 	repoPathForOrphan := ""
 	for _, s := range remainingSessions {
-		wt := resolveWorktreeID(s)
-		referenced[wt] = true
+		referenced[s.WorkingCopyPath] = true
 		repoPathForOrphan = s.RepoPath
 	}
 
@@ -540,33 +961,25 @@ func cmdAutoClean(sm *SessionManager) error {
 		}
 	}
 
+	var orphanVcs VcsBackend
 	if repoPathForOrphan != "" {
-		ntDir := filepath.Join(repoPathForOrphan, ".nanotown")
-		entries, err := os.ReadDir(ntDir)
-		if err == nil {
-			for _, entry := range entries {
-				if !entry.IsDir() {
-					continue
-				}
-				name := entry.Name()
-				if referenced[name] {
-					continue
-				}
-				wtPath := filepath.Join(ntDir, name)
-				// Check for uncommitted changes
-				status, err := runCommand(wtPath, "git", "status", "--porcelain")
-				if err == nil && status != "" {
-					fmt.Printf("Skipping orphaned worktree %s — has uncommitted changes\n", name)
-					skipped++
-					continue
-				}
-				vcs := detectVcs(repoPathForOrphan)
-				if vcs != nil {
-					vcs.RemoveWorkingCopy(repoPathForOrphan, name)
-					fmt.Printf("Cleaned orphaned worktree %s\n", name)
-					cleaned++
-				}
+		orphanVcs = detectVcs(repoPathForOrphan)
+	}
+	if orphanVcs != nil {
+		for _, wt := range repoWorktrees(repoPathForOrphan) {
+			if referenced[wt.Path] {
+				continue
 			}
+			// Check for uncommitted changes
+			status, err := orphanVcs.Status(wt.Path)
+			if err == nil && status != "" {
+				fmt.Printf("Skipping orphaned worktree %s — has uncommitted changes\n", wt.ID)
+				skipped++
+				continue
+			}
+			removeWorktree(orphanVcs, repoPathForOrphan, wt.Path)
+			fmt.Printf("Cleaned orphaned worktree %s\n", wt.ID)
+			cleaned++
 		}
 	}
 
@@ -620,45 +1033,45 @@ func cmdDeleteAll(sm *SessionManager, cwd string) error {
 	cleaned := 0
 	removedWorktrees := map[string]bool{}
 	for _, s := range sessions {
-		stopSession(s, sm)
-		wt := resolveWorktreeID(s)
-		if !removedWorktrees[wt] {
-			vcs.RemoveWorkingCopy(repoPath, wt)
-			removedWorktrees[wt] = true
+		stopSession(s, sm, nil)
+		wtPath := s.WorkingCopyPath
+		if wtPath == "" {
+			wtPath = filepath.Join(repoPath, worktreeDir, resolveWorktreeID(s))
+		}
+		if !removedWorktrees[wtPath] {
+			removeWorktree(vcs, repoPath, wtPath)
+			removedWorktrees[wtPath] = true
 		}
 		sm.Delete(s.ID)
 		cleaned++
 	}
 
-	// Also remove any orphaned worktree directories not referenced by sessions
-	ntDir := filepath.Join(repoPath, ".nanotown")
-	entries, err := os.ReadDir(ntDir)
-	if err == nil {
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				continue
-			}
-			name := entry.Name()
-			if removedWorktrees[name] {
-				continue
-			}
-			vcs.RemoveWorkingCopy(repoPath, name)
-			cleaned++
+	// Also remove any orphaned worktrees not referenced by sessions
+	for _, wt := range repoWorktrees(repoPath) {
+		if removedWorktrees[wt.Path] {
+			continue
 		}
+		removeWorktree(vcs, repoPath, wt.Path)
+		cleaned++
 	}
 
 	fmt.Printf("Cleaned %d session(s)/worktree(s).\n", cleaned)
 	return nil
 }
 
-func formatBanner(id, worktreeID, desc string) string {
+func formatBanner(id, worktreeID, desc string, command []string) string {
 	var b strings.Builder
 	b.WriteString("\n  Nanotown session started\n")
 	fmt.Fprintf(&b, "  Session ID: %-6s Worktree ID: %s\n", id, worktreeID)
 	if desc != "" {
 		fmt.Fprintf(&b, "  Worktree Description: %s\n", desc)
 	}
-	b.WriteString("\n  Type exit to end the session.\n\n")
+	if len(command) > 0 {
+		fmt.Fprintf(&b, "  Command: %s\n", strings.Join(command, " "))
+		b.WriteString("\n  The session ends when the command exits.\n\n")
+	} else {
+		b.WriteString("\n  Type exit to end the session.\n\n")
+	}
 	return b.String()
 }
 
@@ -1,8 +1,32 @@
 package main
 
-var knownAgents = []string{
-	"claude", "opencode", "aider", "kimi", "codex",
-	"gemini", "copilot", "qwen",
+// agentInfo describes an agent nanotown recognizes. inputPatterns are regular
+// expressions that match the agent's own prompts for approval or input,
+// checked against the end of its output.
+type agentInfo struct {
+	name          string
+	inputPatterns []string
+}
+
+var knownAgents = []agentInfo{
+	{"claude", []string{`Do you want to (proceed|make this edit|create|run)`, `No, and tell Claude what to do differently`}},
+	{"opencode", []string{`Permission required`, `Allow (once|always)`}},
+	{"aider", []string{`\(Y\)es/\(N\)o`}},
+	{"kimi", []string{`Approve\?`}},
+	{"codex", []string{`Allow command\?`, `Apply (this )?patch\?`, `Would you like to run`}},
+	{"gemini", []string{`Allow execution`, `Apply this change\?`, `Waiting for user confirmation`}},
+	{"copilot", []string{`Do you want to (run|allow)`}},
+	{"qwen", []string{`Allow execution`, `Apply this change\?`, `Waiting for user confirmation`}},
+}
+
+// Prompts that mean "waiting for you" whichever program prints them.
+var commonInputPatterns = []string{
+	`\[[yY]/[nN]\]`,
+	`\([yY]/[nN]\)`,
+	`\[[yY]es/[nN]o\]`,
+	`(?i)press enter to continue`,
+	`(?i)\b(continue|proceed)\?\s*$`,
+	`(?i)password[^\n]*:\s*$`,
 }
 
 func detectModel(pid int) string {
@@ -11,10 +35,18 @@ func detectModel(pid int) string {
 	}
 	children := getChildProcessNames(pid)
 	for _, name := range children {
-		for _, agent := range knownAgents {
-			if name == agent || name == agent+".exe" {
-				return agent
-			}
+		if agent := matchAgent(name); agent != "" {
+			return agent
+		}
+	}
+	return ""
+}
+
+// matchAgent returns the known agent a process or executable name refers to.
+func matchAgent(name string) string {
+	for _, agent := range knownAgents {
+		if name == agent.name || name == agent.name+".exe" {
+			return agent.name
 		}
 	}
 	return ""
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events a notification can fire on.
+const (
+	notifyIdle  = "idle"  // output stopped for longer than idleAfter
+	notifyExit  = "exit"  // the session ended
+	notifyInput = "input" // the session needs input
+)
+
+const (
+	defaultNotifyIdleAfter   = 60 * time.Second
+	defaultNotifyMinInterval = 30 * time.Second
+)
+
+// notifyConfig is the "notify" section of the config file. Nothing fires
+// until at least one of bell, osc or command is set.
+type notifyConfig struct {
+	Events      []string `json:"events,omitempty"`      // default: idle, exit and input
+	IdleAfter   string   `json:"idleAfter,omitempty"`   // default 60s
+	MinInterval string   `json:"minInterval,omitempty"` // per event, default 30s
+	Bell        bool     `json:"bell,omitempty"`        // ring the terminal bell
+	OSC         string   `json:"osc,omitempty"`         // "9" or "777" for a desktop notification
+	Command     string   `json:"command,omitempty"`     // run with NT_EVENT, NT_SESSION etc. set
+}
+
+// notifier sends a session's notifications, rate limited so a flapping
+// session can't spam.
+type notifier struct {
+	cfg         notifyConfig
+	events      map[string]bool
+	idleAfter   time.Duration
+	minInterval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time // when each event last fired
+}
+
+// newNotifier returns nil if the config doesn't turn any backend on.
+func newNotifier(cfg notifyConfig) (*notifier, error) {
+	if !cfg.Bell && cfg.OSC == "" && cfg.Command == "" {
+		return nil, nil
+	}
+	if cfg.OSC != "" && cfg.OSC != "9" && cfg.OSC != "777" {
+		return nil, fmt.Errorf("invalid notify osc %q (9 or 777)", cfg.OSC)
+	}
+	n := &notifier{
+		cfg:         cfg,
+		events:      map[string]bool{},
+		idleAfter:   defaultNotifyIdleAfter,
+		minInterval: defaultNotifyMinInterval,
+		last:        map[string]time.Time{},
+	}
+	events := cfg.Events
+	if len(events) == 0 {
+		events = []string{notifyIdle, notifyExit, notifyInput}
+	}
+	for _, e := range events {
+		if e != notifyIdle && e != notifyExit && e != notifyInput {
+			return nil, fmt.Errorf("invalid notify event %q (idle, exit or input)", e)
+		}
+		n.events[e] = true
+	}
+	var err error
+	if cfg.IdleAfter != "" {
+		if n.idleAfter, err = parseDurationArg(cfg.IdleAfter); err != nil || n.idleAfter <= 0 {
+			return nil, fmt.Errorf("invalid notify idleAfter %q", cfg.IdleAfter)
+		}
+	}
+	if cfg.MinInterval != "" {
+		if n.minInterval, err = parseDurationArg(cfg.MinInterval); err != nil || n.minInterval < 0 {
+			return nil, fmt.Errorf("invalid notify minInterval %q", cfg.MinInterval)
+		}
+	}
+	return n, nil
+}
+
+// notify fires event for the bridge's session. detail is the prompt for
+// input events and the exit label for exit events.
+func (b *PtyBridge) notify(event string, detail string) {
+	n := b.notifier
+	if n == nil || !n.events[event] {
+		return
+	}
+	n.mu.Lock()
+	if time.Since(n.last[event]) < n.minInterval {
+		n.mu.Unlock()
+		return
+	}
+	n.last[event] = time.Now()
+	n.mu.Unlock()
+
+	s := b.session
+	worktreeID := resolveWorktreeID(s)
+	title := fmt.Sprintf("nt: session %s (%s)", s.ID, worktreeID)
+	var message string
+	switch event {
+	case notifyIdle:
+		message = fmt.Sprintf("idle for %s", formatDuration(int(n.idleAfter.Seconds())))
+	case notifyExit:
+		message = detail
+	case notifyInput:
+		message = "needs input: " + detail
+	}
+
+	// Bell and OSC go to whoever is looking at the session's terminal
+	var seq strings.Builder
+	if n.cfg.Bell {
+		seq.WriteString("\a")
+	}
+	switch n.cfg.OSC {
+	case "9":
+		fmt.Fprintf(&seq, "\033]9;%s: %s\a", oscSafe(title), oscSafe(message))
+	case "777":
+		fmt.Fprintf(&seq, "\033]777;notify;%s;%s\a", oscSafe(title), oscSafe(message))
+	}
+	if seq.Len() > 0 {
+		b.writeTerminal([]byte(seq.String()))
+	}
+
+	if n.cfg.Command != "" {
+		c := sessionHookContext(s)
+		c.extra = []string{"NT_EVENT=" + event, "NT_MESSAGE=" + title + ": " + message, "NT_DETAIL=" + detail}
+		cmd := shellCommand(n.cfg.Command)
+		cmd.Dir = s.WorkingCopyPath
+		cmd.Env = c.env()
+		if err := cmd.Start(); err == nil {
+			go cmd.Wait()
+		}
+	}
+}
+
+// watchIdle calls fire once each time output stops for longer than after.
+func (b *PtyBridge) watchIdle(after time.Duration, fire func()) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var notified int64
+	for {
+		select {
+		case <-b.outputDone:
+			return
+		case now := <-ticker.C:
+			last := b.lastOutput.Load()
+			if last != notified && now.Sub(time.Unix(0, last)) >= after {
+				notified = last
+				fire()
+			}
+		}
+	}
+}
+
+// oscSafe strips characters that would end an OSC sequence early.
+func oscSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7F || r == ';' {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPorts     = 1 // per session
+	defaultPortRange = "20000-29999"
+	maxPorts         = 100
+
+	portLockTimeout = 5 * time.Second
+	portLockStale   = 10 * time.Second // a lock this old was left by a crashed nt
+)
+
+// parsePortRange parses "lo-hi".
+func parsePortRange(spec string) (lo, hi int, err error) {
+	loStr, hiStr, ok := strings.Cut(spec, "-")
+	if ok {
+		lo, err = strconv.Atoi(strings.TrimSpace(loStr))
+		if err == nil {
+			hi, err = strconv.Atoi(strings.TrimSpace(hiStr))
+		}
+	}
+	if !ok || err != nil || lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("invalid port range %q (e.g. %s)", spec, defaultPortRange)
+	}
+	return lo, hi, nil
+}
+
+// holdsPorts reports whether a session's ports are still reserved. They are
+// released when it exits, and a session that died without recording its
+// exit doesn't hold on to them either.
+func holdsPorts(s *Session) bool {
+	return s.EndedAt == "" && s.Alive && (s.PID < 0 || isProcessAlive(s.PID))
+}
+
+// ReservePorts finds a block of count consecutive free TCP ports in
+// [lo, hi], trying prefer first, and records it on the session. Ports are
+// free if no live session holds them and nothing is listening on them.
+func (sm *SessionManager) ReservePorts(s *Session, count, lo, hi int, prefer []int) error {
+	if count <= 0 {
+		return nil
+	}
+	unlock, err := sm.lockPorts()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	reserved := map[int]bool{}
+	for _, other := range sm.ListAll() {
+		if other.ID != s.ID && holdsPorts(other) {
+			for _, p := range other.Ports {
+				reserved[p] = true
+			}
+		}
+	}
+	blockFree := func(start int) (int, bool) {
+		for p := start; p < start+count; p++ {
+			if reserved[p] || !portFree(p) {
+				return p, false
+			}
+		}
+		return 0, true
+	}
+
+	block := -1
+	if len(prefer) == count {
+		if _, ok := blockFree(prefer[0]); ok {
+			block = prefer[0]
+		}
+	}
+	for start := lo; block < 0 && start+count-1 <= hi; start++ {
+		taken, ok := blockFree(start)
+		if ok {
+			block = start
+		} else {
+			start = taken // no block can start at or before a taken port
+		}
+	}
+	if block < 0 {
+		return fmt.Errorf("no %d free port(s) in %d-%d", count, lo, hi)
+	}
+	s.Ports = nil
+	for p := block; p < block+count; p++ {
+		s.Ports = append(s.Ports, p)
+	}
+	return sm.Write(s)
+}
+
+// lockPorts serializes port allocation between nt processes, so two sessions
+// starting at once can't pick the same block.
+func (sm *SessionManager) lockPorts() (unlock func(), err error) {
+	path := filepath.Join(sm.dir, "ports.lock")
+	deadline := time.Now().Add(portLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if info, serr := os.Stat(path); serr == nil && time.Since(info.ModTime()) > portLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to reserve ports: %s is held by another nt process", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// portFree reports whether nothing is listening on the TCP port.
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// portEnv exposes a session's ports to it and its hooks as NT_PORT (the
+// first), and NT_PORT_1, NT_PORT_2 and so on for each port in the block.
+func portEnv(ports []int) []string {
+	if len(ports) == 0 {
+		return nil
+	}
+	env := []string{"NT_PORT=" + strconv.Itoa(ports[0])}
+	for i, p := range ports {
+		env = append(env, fmt.Sprintf("NT_PORT_%d=%d", i+1, p))
+	}
+	return env
+}
+
+// formatPorts writes a block of ports as "20000" or "20000-20002".
+func formatPorts(ports []int) string {
+	switch len(ports) {
+	case 0:
+		return ""
+	case 1:
+		return strconv.Itoa(ports[0])
+	}
+	return fmt.Sprintf("%d-%d", ports[0], ports[len(ports)-1])
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 func runCommand(dir string, args ...string) (string, error) {
@@ -20,3 +21,100 @@ func runCommand(dir string, args ...string) (string, error) {
 	}
 	return result, nil
 }
+
+// procEntry is one row of the process table. cpuTime and rss are filled in
+// when the platform's listing provides them cheaply; readProcessUsage fills
+// them in otherwise.
+type procEntry struct {
+	pid     int
+	ppid    int
+	sid     int // session ID where the platform reports it (Linux), else 0
+	name    string
+	cpuTime time.Duration // user + system
+	rss     int64         // resident memory in bytes
+}
+
+// descendantsOf returns every process below pid in the tree, not including pid.
+func descendantsOf(procs []procEntry, pid int) []procEntry {
+	// BFS to find all descendants
+	descendants := map[int]bool{pid: true}
+	changed := true
+	for changed {
+		changed = false
+		for _, p := range procs {
+			if descendants[p.ppid] && !descendants[p.pid] {
+				descendants[p.pid] = true
+				changed = true
+			}
+		}
+	}
+
+	var result []procEntry
+	for _, p := range procs {
+		if p.pid != pid && descendants[p.pid] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func getChildProcessNames(pid int) []string {
+	var names []string
+	for _, p := range descendantsOf(listProcesses(), pid) {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// processTree returns pid and everything it started.
+func processTree(pid int) []int {
+	var pids []int
+	for _, p := range treeOf(listProcesses(), pid) {
+		pids = append(pids, p.pid)
+	}
+	return pids
+}
+
+// treeOf returns the entry for pid followed by everything it started. Session
+// PTY processes lead their own session, so where the platform reports session
+// IDs this also catches descendants that were orphaned and reparented away
+// from the tree. The pid itself is always included, even if it has exited.
+func treeOf(procs []procEntry, pid int) []procEntry {
+	tree := []procEntry{{pid: pid}}
+	seen := map[int]bool{pid: true}
+	for _, p := range procs {
+		if p.pid == pid {
+			tree[0] = p
+		}
+	}
+	for _, p := range descendantsOf(procs, pid) {
+		tree = append(tree, p)
+		seen[p.pid] = true
+	}
+	for _, p := range procs {
+		if p.sid == pid && !seen[p.pid] {
+			tree = append(tree, p)
+			seen[p.pid] = true
+		}
+	}
+	return tree
+}
+
+// processUsage is resource usage summed over a session's process tree.
+type processUsage struct {
+	cpuTime time.Duration
+	rss     int64
+	procs   int
+}
+
+// treeUsage sums CPU time and resident memory over a session's process tree.
+func treeUsage(procs []procEntry, root int) processUsage {
+	var usage processUsage
+	for _, p := range treeOf(procs, root) {
+		readProcessUsage(&p)
+		usage.cpuTime += p.cpuTime
+		usage.rss += p.rss
+		usage.procs++
+	}
+	return usage
+}
@@ -4,10 +4,12 @@ package main
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 func isProcessAlive(pid int) bool {
@@ -18,56 +20,53 @@ func isProcessAlive(pid int) bool {
 	return err == nil
 }
 
-func killProcess(pid int) {
-	if pid <= 0 {
-		return
-	}
-	p, err := os.FindProcess(pid)
-	if err != nil {
-		return
+func signalProcesses(pids []int, sig syscall.Signal) {
+	for _, pid := range pids {
+		if pid > 0 {
+			syscall.Kill(pid, sig)
+		}
 	}
-	p.Signal(syscall.SIGTERM)
 }
 
-func forceKillProcess(pid int) {
-	if pid <= 0 {
-		return
+// signalGroup signals the process group led by pid. A session's PTY child
+// leads its own session and group, so everything it forks is in the group
+// until it moves itself out.
+func signalGroup(pid int, sig syscall.Signal) {
+	if pid > 0 {
+		syscall.Kill(-pid, sig)
 	}
-	p, err := os.FindProcess(pid)
-	if err != nil {
-		return
-	}
-	p.Signal(syscall.SIGKILL)
 }
 
 func setupConsoleEncoding() {}
 
-func getChildProcessNames(pid int) []string {
+// detachedProcAttr puts a supervisor in its own session so it survives the
+// launching terminal hanging up.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// listProcesses snapshots the process table.
+func listProcesses() []procEntry {
 	// Try /proc first (Linux)
-	if names := getChildProcessNamesProc(pid); names != nil {
-		return names
+	if procs := listProcessesProc(); procs != nil {
+		return procs
 	}
 	// Fallback: use ps (macOS, other Unix)
-	return getChildProcessNamesPS(pid)
+	return listProcessesPS()
 }
 
-func getChildProcessNamesProc(pid int) []string {
+func listProcessesProc() []procEntry {
 	// Check if /proc exists
 	if _, err := os.Stat("/proc"); err != nil {
 		return nil
 	}
 
 	// Read all /proc/<pid>/stat to build parent->child map
-	type proc struct {
-		pid  int
-		ppid int
-		name string
-	}
 	entries, err := os.ReadDir("/proc")
 	if err != nil {
 		return nil
 	}
-	var procs []proc
+	var procs []procEntry
 	for _, entry := range entries {
 		childPid, err := strconv.Atoi(entry.Name())
 		if err != nil {
@@ -77,10 +76,9 @@ func getChildProcessNamesProc(pid int) []string {
 		if err != nil {
 			continue
 		}
-		// Format: <pid> (<name>) <state> <ppid> ...
+		// Format: <pid> (<name>) <state> <ppid> <pgrp> <session> ... <utime> <stime> ...
 		fields := string(data)
 		// Name is between first '(' and last ')'
-		// /proc/pid/stat: "<pid> (<name>) <state> <ppid> ..."
 		// Use LastIndexByte for ')' because process names can contain parens
 		nameStart := strings.IndexByte(fields, '(')
 		nameEnd := strings.LastIndexByte(fields, ')')
@@ -89,54 +87,34 @@ func getChildProcessNamesProc(pid int) []string {
 		}
 		name := fields[nameStart+1 : nameEnd]
 		rest := strings.Fields(fields[nameEnd+2:])
-		if len(rest) < 2 {
+		if len(rest) < 13 {
 			continue
 		}
 		ppid, err := strconv.Atoi(rest[1])
 		if err != nil {
 			continue
 		}
-		procs = append(procs, proc{pid: childPid, ppid: ppid, name: name})
-	}
-
-	// BFS to find all descendants
-	descendants := map[int]bool{pid: true}
-	changed := true
-	for changed {
-		changed = false
-		for _, p := range procs {
-			if descendants[p.ppid] && !descendants[p.pid] {
-				descendants[p.pid] = true
-				changed = true
-			}
-		}
-	}
-
-	var names []string
-	for _, p := range procs {
-		if p.pid != pid && descendants[p.pid] {
-			names = append(names, p.name)
-		}
-	}
-	return names
+		sid, _ := strconv.Atoi(rest[3])
+		// utime and stime (fields 14 and 15) are in clock ticks, which are 1/100s on Linux
+		utime, _ := strconv.ParseInt(rest[11], 10, 64)
+		stime, _ := strconv.ParseInt(rest[12], 10, 64)
+		cpu := time.Duration(utime+stime) * time.Second / 100
+		procs = append(procs, procEntry{pid: childPid, ppid: ppid, sid: sid, name: name, cpuTime: cpu})
+	}
+	return procs
 }
 
-func getChildProcessNamesPS(pid int) []string {
-	// Use ps to list all processes with pid, ppid, comm
-	output, err := runCommand(".", "ps", "-eo", "pid=,ppid=,comm=")
+func listProcessesPS() []procEntry {
+	// Use ps to list all processes with pid, ppid, rss, cpu time, comm (last, since it can contain spaces)
+	output, err := runCommand(".", "ps", "-eo", "pid=,ppid=,rss=,time=,comm=")
 	if err != nil {
 		return nil
 	}
 
-	type proc struct {
-		pid  int
-		ppid int
-		name string
-	}
-	var procs []proc
+	var procs []procEntry
 	for _, line := range strings.Split(output, "\n") {
 		fields := strings.Fields(line)
-		if len(fields) < 3 {
+		if len(fields) < 5 {
 			continue
 		}
 		p, err1 := strconv.Atoi(fields[0])
@@ -144,28 +122,52 @@ func getChildProcessNamesPS(pid int) []string {
 		if err1 != nil || err2 != nil {
 			continue
 		}
-		name := filepath.Base(fields[2])
-		procs = append(procs, proc{pid: p, ppid: pp, name: name})
+		rssKB, _ := strconv.ParseInt(fields[2], 10, 64)
+		name := filepath.Base(fields[4])
+		procs = append(procs, procEntry{pid: p, ppid: pp, name: name, cpuTime: parsePSTime(fields[3]), rss: rssKB * 1024})
 	}
+	return procs
+}
+
+// parsePSTime parses ps's cumulative CPU time: [[dd-]hh:]mm:ss, where macOS
+// adds fractional seconds.
+func parsePSTime(s string) time.Duration {
+	days := 0
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		days, _ = strconv.Atoi(d)
+		s = rest
+	}
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		v, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + v
+	}
+	return time.Duration((float64(days)*86400 + total) * float64(time.Second))
+}
 
-	// BFS to find all descendants
-	descendants := map[int]bool{pid: true}
-	changed := true
-	for changed {
-		changed = false
-		for _, p := range procs {
-			if descendants[p.ppid] && !descendants[p.pid] {
-				descendants[p.pid] = true
-				changed = true
+// readProcessUsage fills in resident memory from /proc/<pid>/status when the
+// process listing came from /proc, which only carries CPU time.
+func readProcessUsage(p *procEntry) {
+	if p.rss > 0 {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(p.pid), "status"))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			fields := strings.Fields(value) // "<n> kB"
+			if len(fields) > 0 {
+				kb, _ := strconv.ParseInt(fields[0], 10, 64)
+				p.rss = kb * 1024
 			}
+			return
 		}
 	}
+}
 
-	var names []string
-	for _, p := range procs {
-		if p.pid != pid && descendants[p.pid] {
-			names = append(names, p.name)
-		}
-	}
-	return names
+// shellCommand runs a user-supplied command line through the shell.
+func shellCommand(line string) *exec.Cmd {
+	return exec.Command("/bin/sh", "-c", line)
 }
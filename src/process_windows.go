@@ -4,7 +4,10 @@ package main
 
 import (
 	"os"
+	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -22,70 +25,100 @@ func isProcessAlive(pid int) bool {
 	return true
 }
 
-func killProcess(pid int) {
-	if pid <= 0 {
-		return
-	}
-	p, err := os.FindProcess(pid)
-	if err != nil {
-		return
+// Windows has no SIGTERM equivalent — Process.Kill() is always a hard kill
+func signalProcesses(pids []int, sig syscall.Signal) {
+	for _, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Kill()
+		}
 	}
-	p.Kill()
 }
 
-// Windows has no SIGTERM equivalent — Process.Kill() is always a hard kill
-func forceKillProcess(pid int) {
-	killProcess(pid)
-}
+// signalGroup does nothing: Windows has no process groups to signal, so the
+// tracked processes are all there is.
+func signalGroup(pid int, sig syscall.Signal) {}
 
 func setupConsoleEncoding() {
 	windows.SetConsoleOutputCP(65001) // UTF-8 codepage
 	windows.SetConsoleCP(65001)
 }
 
-func getChildProcessNames(pid int) []string {
+// detachedProcAttr starts a supervisor without a console so closing the
+// launching window doesn't take it down.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+// listProcesses snapshots the process table.
+func listProcesses() []procEntry {
 	snap, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
 	if err != nil {
 		return nil
 	}
 	defer windows.CloseHandle(snap)
 
-	// Collect all parent->children relationships
-	type proc struct {
-		pid  uint32
-		ppid uint32
-		name string
-	}
-	var procs []proc
-
+	var procs []procEntry
 	var pe windows.ProcessEntry32
 	pe.Size = uint32(unsafe.Sizeof(pe))
 	err = windows.Process32First(snap, &pe)
 	for err == nil {
-		name := windows.UTF16ToString(pe.ExeFile[:])
-		procs = append(procs, proc{pid: pe.ProcessID, ppid: pe.ParentProcessID, name: name})
+		name := strings.ToLower(windows.UTF16ToString(pe.ExeFile[:])) // Windows process names are case-insensitive
+		procs = append(procs, procEntry{pid: int(pe.ProcessID), ppid: int(pe.ParentProcessID), name: name})
 		err = windows.Process32Next(snap, &pe)
 	}
+	return procs
+}
+
+var procGetProcessMemoryInfo = windows.NewLazySystemDLL("psapi.dll").NewProc("GetProcessMemoryInfo")
 
-	// BFS to find all descendants of pid
-	target := uint32(pid)
-	descendants := map[uint32]bool{target: true}
-	changed := true
-	for changed {
-		changed = false
-		for _, p := range procs {
-			if descendants[p.ppid] && !descendants[p.pid] {
-				descendants[p.pid] = true
-				changed = true
-			}
+// processMemoryCounters mirrors PROCESS_MEMORY_COUNTERS from psapi.h.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+// readProcessUsage fills in CPU time and working set size, which the
+// Toolhelp snapshot doesn't report.
+func readProcessUsage(p *procEntry) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION|windows.PROCESS_VM_READ, false, uint32(p.pid))
+	if err != nil {
+		handle, err = windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(p.pid))
+		if err != nil {
+			return
 		}
 	}
+	defer windows.CloseHandle(handle)
 
-	var names []string
-	for _, p := range procs {
-		if p.pid != target && descendants[p.pid] {
-			names = append(names, strings.ToLower(p.name)) // Windows process names are case-insensitive
-		}
+	var creation, exit, kernel, user windows.Filetime
+	if windows.GetProcessTimes(handle, &creation, &exit, &kernel, &user) == nil {
+		// Filetime durations are in 100ns units
+		ticks := int64(kernel.HighDateTime)<<32 | int64(kernel.LowDateTime)
+		ticks += int64(user.HighDateTime)<<32 | int64(user.LowDateTime)
+		p.cpuTime = time.Duration(ticks * 100)
+	}
+
+	var counters processMemoryCounters
+	counters.cb = uint32(unsafe.Sizeof(counters))
+	if r, _, _ := procGetProcessMemoryInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb)); r != 0 {
+		p.rss = int64(counters.workingSetSize)
 	}
-	return names
+}
+
+// shellCommand runs a user-supplied command line through cmd.exe.
+func shellCommand(line string) *exec.Cmd {
+	cmd := exec.Command("cmd.exe")
+	// Pass the line verbatim; Go's argument quoting would mangle cmd.exe syntax
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /s /c "` + line + `"`}
+	return cmd
 }
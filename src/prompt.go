@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How much recent output is searched for a prompt, as plain text: at most
+// promptTailLines lines from the last promptTailSize bytes.
+const (
+	promptTailSize  = 1024
+	promptTailLines = 10
+)
+
+// Output has to stop for this long before it's checked for a prompt: agents
+// waiting on you go quiet, and it keeps regex work off the hot output path.
+const promptCheckInterval = 250 * time.Millisecond
+
+var (
+	commonInputRegexps = mustCompileAll(commonInputPatterns)
+	agentInputRegexps  = compileAgentPatterns()
+)
+
+func compileAgentPatterns() map[string][]*regexp.Regexp {
+	compiled := map[string][]*regexp.Regexp{}
+	for _, agent := range knownAgents {
+		compiled[agent.name] = mustCompileAll(agent.inputPatterns)
+	}
+	return compiled
+}
+
+func mustCompileAll(patterns []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		res = append(res, regexp.MustCompile(p))
+	}
+	return res
+}
+
+// promptDetector watches a session's output for signs that it's waiting on
+// the user: confirmation prompts, permission dialogs, [y/N] questions.
+type promptDetector struct {
+	mu       sync.Mutex
+	stripper ansiStripper
+	tail     *tailBuffer
+	custom   []*regexp.Regexp
+	agent    string // detected agent whose built-in patterns apply; "" checks every agent's
+}
+
+// newPromptDetector compiles the user's own patterns alongside the built-ins.
+func newPromptDetector(custom []string) (*promptDetector, error) {
+	d := &promptDetector{tail: newTailBuffer(promptTailSize)}
+	for _, p := range custom {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q: %w", p, err)
+		}
+		d.custom = append(d.custom, re)
+	}
+	return d, nil
+}
+
+func (d *promptDetector) Write(p []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tail.Write(d.stripper.Strip(p))
+}
+
+// reset forgets output seen so far. Called when the user sends input, so an
+// answered prompt doesn't keep matching.
+func (d *promptDetector) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tail = newTailBuffer(promptTailSize)
+}
+
+// match returns the line of the prompt the output ends on, or "". Only the
+// last few lines count, so a prompt that has since scrolled past doesn't.
+func (d *promptDetector) match() string {
+	d.mu.Lock()
+	text := strings.TrimRight(string(d.tail.Bytes()), " \t\n")
+	agent := d.agent
+	d.mu.Unlock()
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > promptTailLines {
+		text = strings.Join(lines[len(lines)-promptTailLines:], "\n")
+	}
+
+	regexps := append([]*regexp.Regexp{}, d.custom...)
+	regexps = append(regexps, commonInputRegexps...)
+	if agent != "" {
+		regexps = append(regexps, agentInputRegexps[agent]...)
+	} else {
+		for _, res := range agentInputRegexps {
+			regexps = append(regexps, res...)
+		}
+	}
+	// The match nearest the end is the prompt being shown now
+	best := -1
+	for _, re := range regexps {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			best = max(best, loc[0])
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	start := strings.LastIndexByte(text[:best], '\n') + 1
+	end := strings.IndexByte(text[best:], '\n')
+	if end < 0 {
+		end = len(text)
+	} else {
+		end += best
+	}
+	return strings.TrimSpace(text[start:end])
+}
+
+func (d *promptDetector) setAgent(agent string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.agent = agent
+}
+
+// watchPrompts checks for a prompt each time the session's output goes quiet,
+// until the output ends.
+func (b *PtyBridge) watchPrompts() {
+	ticker := time.NewTicker(promptCheckInterval)
+	defer ticker.Stop()
+	var checked int64
+	agentKnown := false
+	for {
+		select {
+		case <-b.outputDone:
+			return
+		case now := <-ticker.C:
+			last := b.lastOutput.Load()
+			if last == checked || now.Sub(time.Unix(0, last)) < promptCheckInterval {
+				continue
+			}
+			checked = last
+			if !agentKnown {
+				agent := detectModel(b.pid)
+				if agent == "" && len(b.session.Command) > 0 {
+					agent = matchAgent(strings.ToLower(filepath.Base(b.session.Command[0])))
+				}
+				if agent != "" {
+					b.prompts.setAgent(agent)
+					agentKnown = true
+				}
+			}
+			b.setWaitingOn(b.prompts.match())
+		}
+	}
+}
+
+// inputReceived notes that someone typed into the session, which answers any
+// prompt it was waiting on.
+func (b *PtyBridge) inputReceived() {
+	if b.prompts == nil {
+		return
+	}
+	b.prompts.reset()
+	b.setWaitingOn("")
+}
+
+// setWaitingOn publishes the prompt the session is waiting on ("" for none)
+// for nt status.
+func (b *PtyBridge) setWaitingOn(prompt string) {
+	b.promptMu.Lock()
+	defer b.promptMu.Unlock()
+	if prompt == b.waitingOn {
+		return
+	}
+	b.waitingOn = prompt
+	path := b.sessionManager.PromptPath(b.session.ID)
+	if prompt == "" {
+		os.Remove(path)
+	} else {
+		os.WriteFile(path, []byte(prompt), 0644) // best-effort
+		b.notify(notifyInput, prompt)
+	}
+}
@@ -2,44 +2,174 @@ package main
 
 import (
 	"io"
+	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const outputDrainTimeout = 500 * time.Millisecond
+
+// The activity heartbeat is written at most this often. Well under the
+// default 2s that nt status treats as still active.
+const activityInterval = 250 * time.Millisecond
+
 type PtyBridge struct {
 	session        *Session
 	sessionManager *SessionManager
 	pid            int
 	ptyReader      io.Reader
 	ptyWriter      io.Writer
-	waitFunc       func()
+	waitFunc       func() (code int, signal string)
 	cleanupFunc    func()
+	resizeFunc     func(cols, rows int)
+	outputDone     chan struct{} // closed once PTY output has been fully read
+	log            *sessionLog   // nil if the log couldn't be opened
+	cast           *castRecorder // nil if the recording couldn't be created
+
+	// Initial PTY size: the launching terminal's, or the size the supervisor
+	// was given for detached sessions.
+	cols int
+	rows int
+
+	// Headless sessions run with stdin or stdout that isn't a terminal (CI,
+	// cron, pipes): output is written as plain text and stdin EOF ends input.
+	headless bool
+	out      io.Writer // where output goes locally; nil for detached sessions
+
+	// Detached sessions have no terminal: I/O goes through the control socket
+	// instead of stdin/stdout.
+	detached   bool
+	listener   net.Listener
+	socketPath string
+	clientMu   sync.Mutex
+	client     net.Conn          // attached client; detached sessions only
+	watchers   map[net.Conn]bool // read-only `nt watch` clients
+	scrollback *tailBuffer
+	launched   chan struct{} // closed once the PTY exists; see startInput
+
+	stopMu     sync.Mutex
+	stopReason string // set by `nt stop` over the control socket before it signals us
+
+	limiter  limiter // nil when the session has no resource limits or only a nice value applies
+	limitHit string  // exit reason for a limit the session ran into
+
+	lastOutput   atomic.Int64  // UnixNano of the last printable output
+	watchdogDone chan struct{} // closed when the session exits; nil without a watchdog
+	stdinDone    chan struct{} // closed when the session exits; nil for detached sessions
+
+	notifier *notifier // nil when notifications are off
+	hooks    hooksConfig
+
+	prompts   *promptDetector // nil disables "needs input" detection
+	promptMu  sync.Mutex
+	waitingOn string // prompt the session is waiting on, or ""
 }
 
-func (b *PtyBridge) WaitFor() {
+// WaitFor blocks until the session process exits and returns its exit code
+// and, if it was killed by a signal, the signal name. Signal deaths use the
+// shell's 128+n convention for the code.
+func (b *PtyBridge) WaitFor() (code int, signal string) {
+	code = -1
 	if b.waitFunc != nil {
-		b.waitFunc()
+		code, signal = b.waitFunc()
+	}
+	if b.watchdogDone != nil {
+		close(b.watchdogDone)
+	}
+	if b.stdinDone != nil {
+		close(b.stdinDone)
+	}
+	// Let the reader drain what the process wrote just before exiting. Bounded,
+	// since background children can hold the PTY open indefinitely.
+	select {
+	case <-b.outputDone:
+	case <-time.After(outputDrainTimeout):
 	}
 	if b.cleanupFunc != nil {
 		b.cleanupFunc()
 	}
+	if b.limiter != nil {
+		b.limitHit = b.limiter.hit()
+		b.limiter.release()
+	}
+	if b.log != nil {
+		b.log.Close()
+	}
+	if b.cast != nil {
+		b.cast.Close()
+	}
+	return code, signal
+}
+
+// StopReason is why nt ended the session, or "" if the process exited on its own.
+func (b *PtyBridge) StopReason() string {
+	b.stopMu.Lock()
+	defer b.stopMu.Unlock()
+	return b.stopReason
+}
+
+// LastOutput is when the session last printed something.
+func (b *PtyBridge) LastOutput() time.Time {
+	return time.Unix(0, b.lastOutput.Load())
+}
+
+// LimitHit is the exit reason for a resource limit the session ran into, or "".
+func (b *PtyBridge) LimitHit() string {
+	return b.limitHit
 }
 
 func (b *PtyBridge) Pid() int {
 	return b.pid
 }
 
+// Resize sets the PTY window size. It follows the primary client: the local
+// terminal for foreground sessions, the attached client for detached ones.
+func (b *PtyBridge) Resize(cols, rows int) {
+	if b.resizeFunc != nil && cols > 0 && rows > 0 {
+		b.resizeFunc(cols, rows)
+		if b.cast != nil {
+			b.cast.Resize(cols, rows)
+		}
+	}
+}
+
 func (b *PtyBridge) startIO() {
-	// PTY output -> real stdout
+	b.outputDone = make(chan struct{})
+	if b.headless {
+		b.out = &strippingWriter{w: os.Stdout}
+	} else if !b.detached {
+		b.out = os.Stdout
+	}
+
+	b.lastOutput.Store(time.Now().UnixNano())
+
+	// PTY output -> real stdout (or the attached client)
 	go func() {
+		defer close(b.outputDone)
+		var lastTouch time.Time
 		buf := make([]byte, 4096)
 		for {
 			n, err := b.ptyReader.Read(buf)
 			if n > 0 {
-				os.Stdout.Write(buf[:n])
+				b.writeOutput(buf[:n])
+				if b.prompts != nil {
+					b.prompts.Write(buf[:n])
+				}
+				if b.log != nil {
+					b.log.Write(buf[:n]) // best-effort
+				}
+				if b.cast != nil {
+					b.cast.Output(buf[:n])
+				}
 				if hasPrintableContent(buf, n) {
-					b.session.LastOutputAt = time.Now().UTC().Format(time.RFC3339Nano)
-					b.sessionManager.Write(b.session) // best-effort
+					now := time.Now()
+					b.lastOutput.Store(now.UnixNano())
+					if now.Sub(lastTouch) >= activityInterval {
+						b.sessionManager.TouchActivity(b.session.ID, now)
+						lastTouch = now
+					}
 				}
 			}
 			if err != nil {
@@ -48,21 +178,86 @@ func (b *PtyBridge) startIO() {
 		}
 	}()
 
-	// Real stdin -> PTY input
+	if b.prompts != nil {
+		go b.watchPrompts()
+	}
+	if b.notifier != nil && b.notifier.events[notifyIdle] {
+		go b.watchIdle(b.notifier.idleAfter, func() { b.notify(notifyIdle, "") })
+	}
+	if b.hooks.OnIdle != "" {
+		idleAfter, _ := b.hooks.idleAfter() // already validated
+		go b.watchIdle(idleAfter, func() {
+			// Output would land in the middle of the session's screen
+			go runHook(b.hooks, hookOnIdle, sessionHookContext(b.session), io.Discard)
+		})
+	}
+
+	if b.detached {
+		return // input arrives over the control socket
+	}
+
+	// Real stdin -> PTY input, until the session exits
+	b.stdinDone = make(chan struct{})
 	go func() {
-		buf := make([]byte, 4096)
+		chunks := stdinChunks()
 		for {
-			n, err := os.Stdin.Read(buf)
-			if n > 0 {
-				b.ptyWriter.Write(buf[:n])
-			}
-			if err != nil {
-				break
+			select {
+			case <-b.stdinDone:
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					if b.headless {
+						// Piped input ran out; pass the EOF on so the command sees it too.
+						// Mid-line, the first EOF only flushes the partial line.
+						if stdinLast != '\n' {
+							b.ptyWriter.Write([]byte(ptyEOF))
+						}
+						b.ptyWriter.Write([]byte(ptyEOF))
+					}
+					return
+				}
+				if _, err := b.ptyWriter.Write(chunk); err != nil {
+					return
+				}
+				b.inputReceived()
 			}
 		}
 	}()
 }
 
+// Stdin is read by one goroutine for the life of the process, so that after
+// an automatic restart the new session's bridge takes over the input instead
+// of competing with the old one's reader. Each chunk goes to whichever bridge
+// receives it; a chunk read between runs waits for the next one.
+var (
+	stdinOnce sync.Once
+	stdinCh   chan []byte // closed at EOF
+	stdinLast byte        // the last byte read; set before stdinCh is closed
+)
+
+func stdinChunks() <-chan []byte {
+	stdinOnce.Do(func() {
+		stdinCh = make(chan []byte)
+		go func() {
+			last := byte('\n')
+			buf := make([]byte, 4096)
+			for {
+				n, err := os.Stdin.Read(buf)
+				if n > 0 {
+					last = buf[n-1]
+					stdinCh <- append([]byte(nil), buf[:n]...)
+				}
+				if err != nil {
+					break
+				}
+			}
+			stdinLast = last
+			close(stdinCh)
+		}()
+	})
+	return stdinCh
+}
+
 // hasPrintableContent returns true if the buffer contains at least one
 // printable character, filtering out pure ANSI escape sequences.
 func hasPrintableContent(buf []byte, length int) bool {
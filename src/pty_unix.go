@@ -6,49 +6,29 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
 	"golang.org/x/term"
 )
 
-func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) error {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/sh"
-	}
+// ptyEOF is what the terminal's EOF key (Ctrl-D) sends.
+const ptyEOF = "\x04"
 
-	// Build the exec line with prompt customization for supported shells.
-	// Green [nt] prefix, similar to how PS shows before the dir in PowerShell.
-	shellBase := filepath.Base(shell)
-	execLine := fmt.Sprintf(`exec "%s"`, shell)
-
-	switch shellBase {
-	case "bash":
-		metaDir := filepath.Join(workDir, ".nanotown")
-		os.MkdirAll(metaDir, 0755)
-		rcFile := filepath.Join(metaDir, "bashrc")
-		os.WriteFile(rcFile, []byte(
-			"[ -f ~/.bashrc ] && . ~/.bashrc\n"+
-				`PS1="\[\033[32m\][nt]\[\033[0m\] $PS1"`+"\n",
-		), 0644)
-		execLine = fmt.Sprintf(`exec "%s" --rcfile "%s"`, shell, rcFile)
-	case "zsh":
-		// zsh reads dotfiles from ZDOTDIR instead of $HOME when set
-		zdotdir := filepath.Join(workDir, ".nanotown", "zsh")
-		os.MkdirAll(zdotdir, 0755)
-		os.WriteFile(filepath.Join(zdotdir, ".zshenv"), []byte(
-			"[ -f \"$HOME/.zshenv\" ] && . \"$HOME/.zshenv\"\n",
-		), 0644)
-		os.WriteFile(filepath.Join(zdotdir, ".zshrc"), []byte(
-			"[ -f \"$HOME/.zshrc\" ] && . \"$HOME/.zshrc\"\n"+
-				"PS1=\"%F{green}[nt]%f $PS1\"\n",
-		), 0644)
-		execLine = fmt.Sprintf(`ZDOTDIR="%s" exec "%s"`, zdotdir, shell)
+func (b *PtyBridge) Launch(workDir string, bannerFile string, title string, command []string) error {
+	var execLine string
+	if len(command) > 0 {
+		// $1 is the banner file; the command's argv follows it
+		execLine = `shift; exec "$@"`
+	} else {
+		execLine = shellExecLine(workDir)
 	}
 
-	// Build launch script: optional banner + optional title + exec into user's shell
+	// Build launch script: optional banner + optional title + exec into user's shell or command
 	var parts []string
 	if bannerFile != "" {
 		parts = append(parts, `cat "$1"; rm -f "$1"`)
@@ -59,37 +39,82 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 	parts = append(parts, execLine)
 	script := strings.Join(parts, "; ")
 
-	var cmd *exec.Cmd
-	if bannerFile != "" {
-		cmd = exec.Command("/bin/sh", "-c", script, "--", bannerFile)
-	} else {
-		cmd = exec.Command("/bin/sh", "-c", script)
-	}
+	shArgs := append([]string{"-c", script, "--", bannerFile}, command...)
+	cmd := exec.Command("/bin/sh", shArgs...)
 	cmd.Dir = workDir
 	cmd.Env = os.Environ()
 
-	var ws *pty.Winsize
-	w, h, sizeErr := term.GetSize(int(os.Stdout.Fd()))
-	if sizeErr == nil {
-		ws = &pty.Winsize{Cols: uint16(w), Rows: uint16(h)}
+	if b.session != nil && b.session.Limits != nil {
+		lim, nice, err := newCgroupLimiter(b.session.ID, *b.session.Limits)
+		if err != nil {
+			return err
+		}
+		if lim != nil {
+			started, err := startInCgroup(lim, cmd)
+			if err != nil {
+				lim.release()
+				return err
+			}
+			defer started()
+			b.limiter = lim
+		}
+		if nice.CPUWeight > 0 {
+			if err := niceCommand(cmd, nice.CPUWeight); err != nil {
+				if b.limiter != nil {
+					b.limiter.release()
+				}
+				return err
+			}
+		}
 	}
+
+	ws := &pty.Winsize{Cols: uint16(b.cols), Rows: uint16(b.rows)}
 	ptmx, err := pty.StartWithSize(cmd, ws)
 	if err != nil {
+		if b.limiter != nil {
+			b.limiter.release()
+		}
 		return err
 	}
 
+	if b.headless {
+		// Don't mix piped input back into the output. Done on the master before
+		// startIO forwards anything, so no input is echoed in the meantime.
+		stty := exec.Command("stty", "-echo")
+		stty.Stdin = ptmx
+		stty.Run()
+	}
+
 	b.pid = cmd.Process.Pid
 	b.ptyReader = ptmx
 	b.ptyWriter = ptmx
 
-	oldState, termErr := term.MakeRaw(int(os.Stdin.Fd()))
+	b.resizeFunc = func(cols, rows int) {
+		pty.Setsize(ptmx, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	}
 
-	b.waitFunc = func() {
+	var oldState *term.State // stays nil when detached or stdin isn't a terminal
+	stopResize := func() {}
+	if !b.detached && !b.headless {
+		oldState, _ = term.MakeRaw(int(os.Stdin.Fd()))
+		stopResize = notifyResize(func() {
+			if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+				b.Resize(w, h)
+			}
+		})
+	}
+
+	b.waitFunc = func() (int, string) {
 		cmd.Wait()
+		if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), unix.SignalName(ws.Signal())
+		}
+		return cmd.ProcessState.ExitCode(), ""
 	}
 	b.cleanupFunc = func() {
+		stopResize()
 		ptmx.Close()
-		if termErr == nil {
+		if oldState != nil {
 			term.Restore(int(os.Stdin.Fd()), oldState)
 		}
 	}
@@ -97,3 +122,56 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 	b.startIO()
 	return nil
 }
+
+// notifyResize calls fn whenever our terminal is resized (SIGWINCH).
+// The returned function stops listening.
+func notifyResize(fn func()) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go func() {
+		for range ch {
+			fn()
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(ch)
+	}
+}
+
+// shellExecLine builds the exec line for the user's shell with prompt customization
+// for supported shells. Green [nt] prefix, similar to how PS shows before the dir in PowerShell.
+func shellExecLine(workDir string) string {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	shellBase := filepath.Base(shell)
+	execLine := fmt.Sprintf(`exec "%s"`, shell)
+
+	switch shellBase {
+	case "bash":
+		metaDir := filepath.Join(workDir, ".nanotown")
+		os.MkdirAll(metaDir, 0755)
+		rcFile := filepath.Join(metaDir, "bashrc")
+		os.WriteFile(rcFile, []byte(
+			"[ -f ~/.bashrc ] && . ~/.bashrc\n"+
+				`PS1="\[\033[32m\][nt]\[\033[0m\] $PS1"`+"\n",
+		), 0644)
+		execLine = fmt.Sprintf(`exec "%s" --rcfile "%s"`, shell, rcFile)
+	case "zsh":
+		// zsh reads dotfiles from ZDOTDIR instead of $HOME when set
+		zdotdir := filepath.Join(workDir, ".nanotown", "zsh")
+		os.MkdirAll(zdotdir, 0755)
+		os.WriteFile(filepath.Join(zdotdir, ".zshenv"), []byte(
+			"[ -f \"$HOME/.zshenv\" ] && . \"$HOME/.zshenv\"\n",
+		), 0644)
+		os.WriteFile(filepath.Join(zdotdir, ".zshrc"), []byte(
+			"[ -f \"$HOME/.zshrc\" ] && . \"$HOME/.zshrc\"\n"+
+				"PS1=\"%F{green}[nt]%f $PS1\"\n",
+		), 0644)
+		execLine = fmt.Sprintf(`ZDOTDIR="%s" exec "%s"`, zdotdir, shell)
+	}
+	return execLine
+}
@@ -6,13 +6,17 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/UserExistsError/conpty"
 	"golang.org/x/sys/windows"
 	"golang.org/x/term"
 )
 
-func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) error {
+// ptyEOF is Ctrl-Z then Enter, which console programs read as end of input.
+const ptyEOF = "\x1a\r"
+
+func (b *PtyBridge) Launch(workDir string, bannerFile string, title string, command []string) error {
 	// Windows consoles don't process ANSI escapes by default; enable VT processing
 	hStdout, _ := windows.GetStdHandle(windows.STD_OUTPUT_HANDLE)
 	var savedOutputMode uint32
@@ -22,12 +26,14 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 	}
 
 	// Set stdin to raw mode
-	oldState, termErr := term.MakeRaw(int(os.Stdin.Fd()))
+	var oldState *term.State // stays nil when detached or stdin isn't a terminal
+	if !b.detached && !b.headless {
+		oldState, _ = term.MakeRaw(int(os.Stdin.Fd()))
+	}
 
-	opts := []conpty.ConPtyOption{conpty.ConPtyWorkDir(workDir)}
-	w, h, sizeErr := term.GetSize(int(os.Stdout.Fd()))
-	if sizeErr == nil {
-		opts = append(opts, conpty.ConPtyDimensions(w, h))
+	opts := []conpty.ConPtyOption{
+		conpty.ConPtyWorkDir(workDir),
+		conpty.ConPtyDimensions(b.cols, b.rows),
 	}
 
 	// Green [nt] prompt prefix — $E is cmd.exe's escape character for ANSI codes
@@ -38,7 +44,18 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 	os.Setenv("PROMPT", "$E[32m[nt]$E[0m "+existingPrompt)
 
 	startCmd := "cmd.exe"
-	if bannerFile != "" {
+	if len(command) > 0 {
+		// /c exits with the command; /s keeps cmd.exe from mangling the quotes inside
+		var parts []string
+		if bannerFile != "" {
+			parts = append(parts, fmt.Sprintf(`@type "%s" & @del "%s"`, bannerFile, bannerFile))
+		}
+		if title != "" {
+			parts = append(parts, "@title "+title)
+		}
+		parts = append(parts, windows.ComposeCommandLine(command))
+		startCmd = fmt.Sprintf(`cmd.exe /s /c "%s"`, strings.Join(parts, " & "))
+	} else if bannerFile != "" {
 		// /k runs commands then stays open; @ suppresses command echo
 		startCmd = fmt.Sprintf(`cmd.exe /k @type "%s" & @del "%s" & @title %s`, bannerFile, bannerFile, title)
 	} else if title != "" {
@@ -47,7 +64,7 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 
 	cpty, err := conpty.Start(startCmd, opts...)
 	if err != nil {
-		if termErr == nil {
+		if oldState != nil {
 			term.Restore(int(os.Stdin.Fd()), oldState)
 		}
 		if hasOutput {
@@ -56,16 +73,49 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 		return err
 	}
 
+	if b.session != nil && b.session.Limits != nil {
+		if b.limiter, err = newJobLimiter(*b.session.Limits); err == nil {
+			err = b.limiter.add(cpty.Pid())
+		}
+		if err != nil {
+			if b.limiter != nil {
+				b.limiter.release()
+				b.limiter = nil
+			}
+			if l := *b.session.Limits; l.MaxMem > 0 || l.MaxProcs > 0 {
+				if p, perr := os.FindProcess(cpty.Pid()); perr == nil {
+					p.Kill()
+				}
+				cpty.Close()
+				if oldState != nil {
+					term.Restore(int(os.Stdin.Fd()), oldState)
+				}
+				if hasOutput {
+					windows.SetConsoleMode(hStdout, savedOutputMode)
+				}
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %s; --cpu-weight will not apply\n", err)
+		}
+	}
+
 	b.pid = cpty.Pid()
 	b.ptyReader = cpty
 	b.ptyWriter = cpty
+	b.resizeFunc = func(cols, rows int) {
+		cpty.Resize(cols, rows)
+	}
 
-	b.waitFunc = func() {
-		cpty.Wait(context.Background())
+	b.waitFunc = func() (int, string) {
+		code, err := cpty.Wait(context.Background())
+		if err != nil {
+			return -1, ""
+		}
+		return int(code), ""
 	}
 	b.cleanupFunc = func() {
 		cpty.Close()
-		if termErr == nil {
+		if oldState != nil {
 			term.Restore(int(os.Stdin.Fd()), oldState)
 		}
 		if hasOutput {
@@ -76,3 +126,9 @@ func (b *PtyBridge) Launch(workDir string, bannerFile string, title string) erro
 	b.startIO()
 	return nil
 }
+
+// Windows consoles have no SIGWINCH, so the PTY keeps its launch size unless a
+// client reports a resize over the control socket.
+func notifyResize(fn func()) func() {
+	return func() {}
+}
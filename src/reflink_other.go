@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// cloneFile has no copy-on-write support here, so files are always copied.
+func cloneFile(src, dst string) error {
+	return errors.ErrUnsupported
+}
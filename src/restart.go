@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Automatic restarts back off from restartDelay, doubling up to restartMaxDelay,
+// so a command that fails immediately doesn't spin.
+const (
+	restartDelay    = time.Second
+	restartMaxDelay = 30 * time.Second
+)
+
+// parseRestartPolicy validates a --restart policy: "no", "on-failure" (no
+// limit) or "on-failure:N" (at most N restarts). Returns the restart limit,
+// -1 for unlimited.
+func parseRestartPolicy(spec string) (int, error) {
+	if spec == "" || spec == "no" {
+		return 0, nil
+	}
+	rest, ok := strings.CutPrefix(spec, "on-failure")
+	if !ok {
+		return 0, fmt.Errorf("invalid --restart %q (no, on-failure or on-failure:N)", spec)
+	}
+	if rest == "" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(rest, ":"))
+	if !strings.HasPrefix(rest, ":") || err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid --restart %q (no, on-failure or on-failure:N)", spec)
+	}
+	return n, nil
+}
+
+// shouldRestart reports whether an exited session's restart policy calls for
+// another run. Only the command failing counts: sessions that nanotown ended
+// on purpose, with nt stop or the idle and runtime watchdog, are never
+// restarted.
+func shouldRestart(s *Session) bool {
+	if s.ExitCode == nil || *s.ExitCode == 0 {
+		return false
+	}
+	if s.ExitReason != exitReasonExited && s.ExitReason != exitReasonMemLimit && s.ExitReason != exitReasonProcLimit {
+		return false
+	}
+	limit, err := parseRestartPolicy(s.Restart)
+	if err != nil || limit == 0 {
+		return false
+	}
+	return limit < 0 || s.Restarts < limit
+}
+
+// successorSession creates the session record for a relaunch of prev on the
+// same worktree with the same command and settings. restarts counts the
+// automatic restarts so far, for the restart limit.
+func successorSession(sm *SessionManager, prev *Session, restarts int) (*Session, error) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	next := &Session{
+		ID:              generateID(sm),
+		RepoPath:        prev.RepoPath,
+		WorkingCopyPath: prev.WorkingCopyPath,
+		Alive:           true,
+		PID:             -1,
+		StartedAt:       now,
+		LastOutputAt:    now,
+		Worktree:        prev.Worktree,
+		Detached:        prev.Detached,
+		Command:         prev.Command,
+		Profile:         prev.Profile,
+		Env:             prev.Env,
+		Limits:          prev.Limits,
+		IdleTimeout:     prev.IdleTimeout,
+		MaxRuntime:      prev.MaxRuntime,
+		Restart:         prev.Restart,
+		RestartOf:       prev.ID,
+		Restarts:        restarts,
+	}
+	if err := sm.Write(next); err != nil {
+		return nil, err
+	}
+	if len(prev.Ports) > 0 {
+		// Keep the same ports if they're free, so URLs stay the same
+		cfg, _ := loadSessionConfig(prev)
+		lo, hi, _ := cfg.portRange() // falls back to the default range
+		if err := sm.ReservePorts(next, len(prev.Ports), lo, hi, prev.Ports); err != nil {
+			next.Alive = false
+			sm.Write(next) // best-effort
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// runWithRestarts runs a session in this process and keeps relaunching it
+// while its restart policy asks for it. newBridge makes a fresh bridge for
+// each run.
+func runWithRestarts(sm *SessionManager, session *Session, desc string, newBridge func() *PtyBridge) error {
+	for {
+		os.Setenv("NT_SESSION", session.ID)
+		bridge := newBridge()
+		err := runSession(sm, session, desc, bridge)
+		if !shouldRestart(session) {
+			return err
+		}
+
+		next, werr := successorSession(sm, session, session.Restarts+1)
+		if werr != nil {
+			return werr
+		}
+		// Until the relaunch, the waiting nt process stands in for the session,
+		// so nt stop can still end the chain during the backoff
+		next.PID = os.Getpid()
+		sm.Write(next) // best-effort
+
+		msgOut := os.Stdout
+		if bridge.headless {
+			msgOut = os.Stderr
+		}
+		delay := min(restartDelay<<session.Restarts, restartMaxDelay)
+		limit, _ := parseRestartPolicy(session.Restart)
+		attempt := fmt.Sprintf("restart %d", next.Restarts)
+		if limit > 0 {
+			attempt += fmt.Sprintf(" of %d", limit)
+		}
+		fmt.Fprintf(msgOut, "Restarting as session %s in %s (%s)...\n", next.ID, delay, attempt)
+		time.Sleep(delay)
+		session = next
+	}
+}
+
+// cmdRestart relaunches a session on its worktree with the same command and
+// settings, stopping it first if it's still running.
+func cmdRestart(target string, sm *SessionManager) error {
+	prev, err := sm.Read(target)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(prev.WorkingCopyPath); err != nil {
+		return fmt.Errorf("worktree %s no longer exists", resolveWorktreeID(prev))
+	}
+	if prev.Alive && isProcessAlive(prev.PID) {
+		stopSession(prev, sm, nil)
+	}
+
+	session, err := successorSession(sm, prev, 0)
+	if err != nil {
+		return err
+	}
+	worktreeID := resolveWorktreeID(session)
+	desc := readDescription(session.WorkingCopyPath)
+
+	os.Setenv("NT_SESSION", session.ID)
+	os.Setenv("NT_BRANCH", worktreeID)
+	defer os.Unsetenv("NT_SESSION")
+	defer os.Unsetenv("NT_BRANCH")
+
+	if session.Detached {
+		if err := spawnSupervisor(session); err != nil {
+			session.Alive = false
+			sm.Write(session) // best-effort
+			return err
+		}
+		fmt.Printf("Session %s restarted as session %s in the background on worktree %s.\n", prev.ID, session.ID, worktreeID)
+		fmt.Printf("Attach with: nt attach %s\n", session.ID)
+		return nil
+	}
+	headless := isHeadless()
+	return runWithRestarts(sm, session, desc, func() *PtyBridge {
+		return &PtyBridge{headless: headless}
+	})
+}
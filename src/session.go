@@ -6,19 +6,77 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Session struct {
-	ID              string `json:"id"`
-	Model           string `json:"model"`
-	RepoPath        string `json:"repoPath"`
-	WorkingCopyPath string `json:"workingCopyPath"`
-	SourceBranch    string `json:"sourceBranch,omitempty"` // cache for display; authoritative source is .nanotown/source-branch
-	Alive           bool   `json:"alive"`
-	PID             int    `json:"pid"`
-	StartedAt       string `json:"startedAt"`
-	LastOutputAt    string `json:"lastOutputAt"`
-	Worktree        string `json:"worktree,omitempty"` // fallback; prefer resolveWorktreeID() which uses WorkingCopyPath
+	ID              string   `json:"id"`
+	Model           string   `json:"model"`
+	RepoPath        string   `json:"repoPath"`
+	WorkingCopyPath string   `json:"workingCopyPath"`
+	SourceBranch    string   `json:"sourceBranch,omitempty"` // cache for display; authoritative source is .nanotown/source-branch
+	Alive           bool     `json:"alive"`
+	PID             int      `json:"pid"`
+	StartedAt       string   `json:"startedAt"`
+	LastOutputAt    string   `json:"lastOutputAt"`
+	Worktree        string   `json:"worktree,omitempty"` // fallback; prefer resolveWorktreeID() which uses WorkingCopyPath
+	Detached        bool     `json:"detached,omitempty"`
+	Command         []string `json:"command,omitempty"`    // argv run instead of an interactive shell
+	Profile         string   `json:"profile,omitempty"`    // from nt -p; its settings apply for the whole session
+	Env             []string `json:"env,omitempty"`        // the config's env as resolved at start, KEY=value
+	ExitCode        *int     `json:"exitCode,omitempty"`   // nil until the session's process has been reaped
+	ExitSignal      string   `json:"exitSignal,omitempty"` // e.g. SIGKILL, when the process died from a signal
+	ExitReason      string   `json:"exitReason,omitempty"` // one of the exitReason constants
+	EndedAt         string   `json:"endedAt,omitempty"`
+
+	Limits      *resourceLimits `json:"limits,omitempty"`      // what the session was started with; nil for none
+	IdleTimeout string          `json:"idleTimeout,omitempty"` // Go duration; stopped after this long without output
+	MaxRuntime  string          `json:"maxRuntime,omitempty"`  // Go duration; stopped after running this long
+	Restart     string          `json:"restart,omitempty"`     // restart policy: on-failure or on-failure:N
+	RestartOf   string          `json:"restartOf,omitempty"`   // ID of the session this one relaunched
+	Restarts    int             `json:"restarts,omitempty"`    // automatic restarts so far in this chain
+	Ports       []int           `json:"ports,omitempty"`       // TCP ports reserved for the session, until it ends
+
+	// Resource usage of the session's process tree, sampled for display only
+	CPUPercent float64 `json:"-"` // negative until two samples can be compared
+	MemBytes   int64   `json:"-"`
+	Procs      int     `json:"-"`
+
+	NeedsInput string `json:"-"` // the prompt a running session is waiting on, from its prompt file
+
+	ActiveThreshold time.Duration `json:"-"` // from the repo's config; 0 for the default
+}
+
+// Who or what ended a session.
+const (
+	exitReasonExited  = "exited"  // the shell or command ended on its own
+	exitReasonStopped = "stopped" // nt stop, stopall or delete
+	exitReasonKilled  = "killed"  // nt stop had to force kill it
+
+	exitReasonMemLimit  = "mem-limit"  // went over --max-mem
+	exitReasonProcLimit = "proc-limit" // ran into --max-procs
+
+	exitReasonIdleTimeout = "idle-timeout" // the watchdog stopped it after --idle-timeout without output
+	exitReasonMaxRuntime  = "max-runtime"  // the watchdog stopped it after --max-runtime
+)
+
+// timeouts returns the session's watchdog timeouts; zero means none.
+func (s *Session) timeouts() (idle, maxRuntime time.Duration) {
+	idle, _ = time.ParseDuration(s.IdleTimeout)
+	maxRuntime, _ = time.ParseDuration(s.MaxRuntime)
+	return idle, maxRuntime
+}
+
+// recordExit marks the session as ended with the given status.
+func (s *Session) recordExit(code int, signal string, reason string) {
+	if reason == "" {
+		reason = exitReasonExited
+	}
+	s.Alive = false
+	s.ExitCode = &code
+	s.ExitSignal = signal
+	s.ExitReason = reason
+	s.EndedAt = time.Now().UTC().Format(time.RFC3339Nano)
 }
 
 type SessionManager struct {
@@ -40,13 +98,92 @@ func (sm *SessionManager) Write(s *Session) error {
 	if err != nil {
 		return fmt.Errorf("failed to save session: %w", err)
 	}
-	path := filepath.Join(sm.dir, s.ID+".json")
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	// Write a temp file and rename it into place, so readers never see a partial file
+	f, err := os.CreateTemp(sm.dir, s.ID+".json.*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		os.Chmod(f.Name(), 0644) // CreateTemp uses 0600
+		err = os.Rename(f.Name(), filepath.Join(sm.dir, s.ID+".json"))
+	}
+	if err != nil {
+		os.Remove(f.Name())
 		return fmt.Errorf("failed to write session file: %w", err)
 	}
 	return nil
 }
 
+func (sm *SessionManager) Read(id string) (*Session, error) {
+	data, err := os.ReadFile(filepath.Join(sm.dir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", id, err)
+	}
+	sm.loadActivity(&s)
+	return &s, nil
+}
+
+// ActivityPath is a running session's heartbeat file. Its mtime is the time
+// of the session's last output, so activity doesn't rewrite the session JSON.
+func (sm *SessionManager) ActivityPath(id string) string {
+	return filepath.Join(sm.dir, id+".active")
+}
+
+// TouchActivity records t as the session's last output time.
+func (sm *SessionManager) TouchActivity(id string, t time.Time) {
+	path := sm.ActivityPath(id)
+	if err := os.Chtimes(path, t, t); err != nil {
+		if f, err := os.Create(path); err == nil {
+			f.Close()
+			os.Chtimes(path, t, t) // best-effort
+		}
+	}
+}
+
+// PromptPath exists while a running session is waiting for input, and holds
+// the prompt it's waiting on.
+func (sm *SessionManager) PromptPath(id string) string {
+	return filepath.Join(sm.dir, id+".prompt")
+}
+
+// loadActivity brings LastOutputAt up to date from the heartbeat file and
+// picks up the prompt the session is waiting on, if any.
+func (sm *SessionManager) loadActivity(s *Session) {
+	if data, err := os.ReadFile(sm.PromptPath(s.ID)); err == nil {
+		s.NeedsInput = string(data)
+	}
+	info, err := os.Stat(sm.ActivityPath(s.ID))
+	if err != nil {
+		return
+	}
+	if last, err := time.Parse(time.RFC3339Nano, s.LastOutputAt); err != nil || info.ModTime().After(last) {
+		s.LastOutputAt = info.ModTime().UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// SocketPath is where a running session's bridge listens for control clients.
+func (sm *SessionManager) SocketPath(id string) string {
+	return filepath.Join(sm.dir, id+".sock")
+}
+
+// LogPath is where a session's PTY output is recorded for `nt logs`.
+func (sm *SessionManager) LogPath(id string) string {
+	return filepath.Join(sm.dir, id+".log")
+}
+
+// CastPath is where a session's asciicast recording is written for `nt replay`.
+func (sm *SessionManager) CastPath(id string) string {
+	return filepath.Join(sm.dir, id+".cast")
+}
+
 func (sm *SessionManager) ListAll() []*Session {
 	var sessions []*Session
 	entries, err := os.ReadDir(sm.dir)
@@ -65,6 +202,7 @@ func (sm *SessionManager) ListAll() []*Session {
 		if err := json.Unmarshal(data, &s); err != nil {
 			continue
 		}
+		sm.loadActivity(&s)
 		sessions = append(sessions, &s)
 	}
 	return sessions
@@ -84,5 +222,9 @@ func (sm *SessionManager) ListForRepo(repoPath string) []*Session {
 func (sm *SessionManager) Delete(id string) {
 	path := filepath.Join(sm.dir, id+".json")
 	os.Remove(path)
+	os.Remove(sm.LogPath(id))
+	os.Remove(sm.LogPath(id) + ".1")
+	os.Remove(sm.CastPath(id))
+	os.Remove(sm.ActivityPath(id))
+	os.Remove(sm.PromptPath(id))
 }
-
@@ -9,6 +9,10 @@ import (
 	"time"
 )
 
+// A session counts as active for this long after its last output, so normal
+// agent pauses don't flicker between active and idle.
+const defaultActiveThreshold = 2 * time.Second
+
 var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
 
 // Derives frame from wall clock so all spinners animate in sync
@@ -29,13 +33,37 @@ func sortSessions(sessions []*Session) {
 
 func statusOrder(s *Session) int {
 	if s.Alive && isProcessAlive(s.PID) {
+		if s.NeedsInput != "" {
+			return 0 // needs input — blocked on you, so first
+		}
 		t, err := time.Parse(time.RFC3339Nano, s.LastOutputAt)
-		if err != nil || time.Since(t).Seconds() < 2 {
-			return 0 // active — 2s threshold prevents flickering during normal agent pauses
+		if err != nil || time.Since(t) < activeThreshold(s) {
+			return 1 // active — the threshold prevents flickering during normal agent pauses
 		}
-		return 1 // idle
+		return 2 // idle
+	}
+	return 3 // exited
+}
+
+// modelLabel is what the MODEL column shows: the profile a session was
+// started with, or else the model detected from its processes.
+func modelLabel(s *Session) string {
+	if s.Profile != "" {
+		return s.Profile
+	}
+	if s.Model != "" {
+		return s.Model
+	}
+	return "\u2014"
+}
+
+// activeThreshold is how long after its last output a session still shows as
+// active rather than idle.
+func activeThreshold(s *Session) time.Duration {
+	if s.ActiveThreshold > 0 {
+		return s.ActiveThreshold
 	}
-	return 2 // exited
+	return defaultActiveThreshold
 }
 
 func lastActiveTime(s *Session) time.Time {
@@ -53,18 +81,42 @@ func lastActiveTime(s *Session) time.Time {
 }
 
 // refreshSessionInfo runs expensive operations (git, process scanning) and caches results on sessions.
-func refreshSessionInfo(sessions []*Session, sm *SessionManager, worktrees []worktreeInfo) {
+func refreshSessionInfo(sessions []*Session, sm *SessionManager, worktrees []worktreeInfo, usage *usageSampler) {
 	updateAliveFlags(sessions, sm)
+	usage.sample(sessions)
 
 	// Detect models for alive sessions
 	for _, s := range sessions {
 		if s.Alive && isProcessAlive(s.PID) {
 			detected := detectModel(s.PID)
-			if detected != "" {
+			if detected == "" && len(s.Command) > 0 {
+				// The command is exec'd as the session process itself, not a child
+				detected = matchAgent(strings.ToLower(filepath.Base(s.Command[0])))
+			}
+			if detected != "" && detected != s.Model {
 				s.Model = detected
-				sm.Write(s) // cache for after exit
+				// Cache for after exit, on a fresh copy so an exit recorded
+				// since we listed the session isn't overwritten
+				if latest, err := sm.Read(s.ID); err == nil && latest.EndedAt == "" {
+					latest.Model = detected
+					sm.Write(latest) // best-effort
+				}
+			}
+		}
+	}
+
+	// Each repo's config (or profile) can change how long a quiet session counts as active
+	thresholds := map[[2]string]time.Duration{}
+	for _, s := range sessions {
+		key := [2]string{s.RepoPath, s.Profile}
+		d, ok := thresholds[key]
+		if !ok {
+			if cfg, err := loadSessionConfig(s); err == nil {
+				d, _ = cfg.activeThreshold()
 			}
+			thresholds[key] = d
 		}
+		s.ActiveThreshold = d
 	}
 
 	// Cache source branch on each session from worktree info
@@ -102,15 +154,12 @@ func renderStatus(sessions []*Session, worktrees []worktreeInfo) (string, int) {
 		b.WriteString("\n  No active sessions.")
 		lines++
 	} else {
-		fmt.Fprintf(&b, "\n%-16s %-10s %-7s %-10s %-12s %-10s %-10s %-12s %s",
-			"REPO", "BRANCH", "SESSION", "MODEL", "STATUS", "WORKTREE", "STARTED", "LAST ACTIVE", "DESCRIPTION")
+		fmt.Fprintf(&b, "\n%-16s %-10s %-7s %-10s %-12s %-5s %-6s %-5s %-10s %-10s %-12s %s",
+			"REPO", "BRANCH", "SESSION", "MODEL", "STATUS", "CPU%", "MEM", "LEFT", "WORKTREE", "STARTED", "LAST ACTIVE", "DESCRIPTION")
 		lines++
 
 		for _, s := range sessions {
-			model := s.Model
-			if model == "" {
-				model = "\u2014"
-			}
+			model := modelLabel(s)
 			status := formatSessionStatus(s, true)
 			started := formatTimeAgo(s.StartedAt)
 			wt := resolveWorktreeID(s)
@@ -118,8 +167,8 @@ func renderStatus(sessions []*Session, worktrees []worktreeInfo) (string, int) {
 			if branch == "" {
 				branch = "?"
 			}
-			fmt.Fprintf(&b, "\n%-16s %-10s %-7s %-10s %s %-10s %-10s %-12s %s",
-				shortRepoPath(s.RepoPath), branch, s.ID, model, status, wt, started, formatTimeAgo(s.LastOutputAt), wtDesc[wt])
+			fmt.Fprintf(&b, "\n%-16s %-10s %-7s %-10s %s %-5s %-6s %-5s %-10s %-10s %-12s %s",
+				shortRepoPath(s.RepoPath), branch, s.ID, model, status, formatCPU(s), formatMem(s), formatTimeLeft(s), wt, started, formatTimeAgo(s.LastOutputAt), wtDesc[wt])
 			lines++
 		}
 	}
@@ -167,6 +216,15 @@ func readSourceBranch(wtPath string) string {
 	return strings.TrimSpace(string(data))
 }
 
+// readDescription reads the worktree description from its .nanotown/ metadata directory.
+func readDescription(wtPath string) string {
+	data, err := os.ReadFile(filepath.Join(wtPath, ".nanotown", "description"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
 // resolveWorktreeID returns the worktree ID for a session.
 // Priority: WorkingCopyPath (canonical), then explicit Worktree field, then session ID.
 func resolveWorktreeID(s *Session) string {
@@ -179,7 +237,7 @@ func resolveWorktreeID(s *Session) string {
 	return s.ID
 }
 
-// listWorktrees scans .nanotown/ directories across all repos referenced by sessions.
+// listWorktrees finds the worktrees of all repos referenced by sessions.
 func listWorktrees(sessions []*Session) []worktreeInfo {
 	// Collect unique repo paths from sessions
 	repoPaths := map[string]bool{}
@@ -198,29 +256,15 @@ func listWorktrees(sessions []*Session) []worktreeInfo {
 
 	var result []worktreeInfo
 	for repoPath := range repoPaths {
-		ntDir := filepath.Join(repoPath, ".nanotown")
-		entries, err := os.ReadDir(ntDir)
-		if err != nil {
-			continue
-		}
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				continue
-			}
-			name := entry.Name()
-			sessionIDs := wtSessions[name]
+		for _, wt := range repoWorktrees(repoPath) {
+			sessionIDs := wtSessions[wt.ID]
 			label := "(none)"
 			if len(sessionIDs) > 0 {
 				label = strings.Join(sessionIDs, ", ")
 			}
-			wtPath := filepath.Join(ntDir, name)
-			branch := readSourceBranch(wtPath)
-			desc := ""
-			data, err := os.ReadFile(filepath.Join(wtPath, ".nanotown", "description"))
-			if err == nil {
-				desc = strings.TrimSpace(string(data))
-			}
-			result = append(result, worktreeInfo{id: name, repo: repoPath, branch: branch, description: desc, sessionList: label})
+			branch := readSourceBranch(wt.Path)
+			desc := readDescription(wt.Path)
+			result = append(result, worktreeInfo{id: wt.ID, repo: repoPath, branch: branch, description: desc, sessionList: label})
 		}
 	}
 	return result
@@ -249,7 +293,14 @@ func shortRepoPath(fullPath string) string {
 
 func formatSessionStatus(s *Session, showSpinner bool) string {
 	if !s.Alive {
-		return fmt.Sprintf("\033[2m%-12s\033[0m", "exited") // dim
+		label := exitLabel(s)
+		if strings.HasPrefix(label, "crashed") || strings.HasSuffix(label, "limit") || label == "timed out" {
+			return fmt.Sprintf("\033[31m%-12s\033[0m", label) // red
+		}
+		return fmt.Sprintf("\033[2m%-12s\033[0m", label) // dim
+	}
+	if s.NeedsInput != "" {
+		return fmt.Sprintf("\033[1;7;35m%-12s\033[0m", "needs input") // bold magenta, reversed
 	}
 	prefix := ""
 	if showSpinner {
@@ -262,14 +313,37 @@ func formatSessionStatus(s *Session, showSpinner bool) string {
 	if err != nil {
 		return fmt.Sprintf("\033[32m%-12s\033[0m", prefix+"active")
 	}
-	seconds := int(time.Since(t).Seconds())
-	if seconds < 2 {
+	if time.Since(t) < activeThreshold(s) {
 		return fmt.Sprintf("\033[32m%-12s\033[0m", prefix+"active") // green
 	}
-	label := prefix + "idle " + formatDuration(seconds)
+	label := prefix + "idle " + formatDuration(int(time.Since(t).Seconds()))
 	return fmt.Sprintf("\033[33m%-12s\033[0m", label) // yellow
 }
 
+// exitLabel summarizes how a session ended: "exited 0" for a clean exit,
+// "crashed N" for a non-zero code or an unexpected signal, "stopped" or
+// "killed" when nt ended it, "mem limit" or "proc limit" when it ran into a
+// resource limit, and "timed out" when the watchdog stopped it. Sessions from before exit tracking show "exited".
+func exitLabel(s *Session) string {
+	switch s.ExitReason {
+	case exitReasonStopped, exitReasonKilled:
+		return s.ExitReason
+	case exitReasonMemLimit:
+		return "mem limit"
+	case exitReasonProcLimit:
+		return "proc limit"
+	case exitReasonIdleTimeout, exitReasonMaxRuntime:
+		return "timed out"
+	}
+	if s.ExitCode == nil || *s.ExitCode < 0 {
+		return "exited"
+	}
+	if *s.ExitCode == 0 {
+		return "exited 0"
+	}
+	return fmt.Sprintf("crashed %d", *s.ExitCode)
+}
+
 func formatTimeAgo(isoTimestamp string) string {
 	if isoTimestamp == "" {
 		return "?"
@@ -291,3 +365,107 @@ func formatDuration(totalSeconds int) string {
 	}
 	return fmt.Sprintf("%dh", totalSeconds/3600)
 }
+
+// cmdInfo prints everything nanotown knows about one session.
+func cmdInfo(target string, sm *SessionManager) error {
+	s, err := sm.Read(target)
+	if err != nil {
+		return err
+	}
+	updateAliveFlags([]*Session{s}, sm)
+
+	status := "running"
+	if !s.Alive {
+		status = exitLabel(s)
+	} else if s.NeedsInput != "" {
+		status = "needs input"
+	}
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Printf("%-13s %s\n", label, value)
+		}
+	}
+	row("Session", s.ID)
+	row("Status", status)
+	row("Repo", s.RepoPath)
+	row("Branch", readSourceBranch(s.WorkingCopyPath))
+	row("Worktree", resolveWorktreeID(s))
+	row("Path", s.WorkingCopyPath)
+	row("Description", readDescription(s.WorkingCopyPath))
+	row("Profile", s.Profile)
+	row("Model", s.Model)
+	if s.Alive {
+		row("Waiting on", s.NeedsInput)
+	}
+	if len(s.Command) > 0 {
+		row("Command", strings.Join(s.Command, " "))
+	}
+	if s.PID > 0 {
+		row("PID", fmt.Sprintf("%d", s.PID))
+	}
+	if s.Detached {
+		row("Detached", "yes")
+	}
+	if s.Limits != nil {
+		row("Limits", s.Limits.String())
+	}
+	if len(s.Ports) > 0 {
+		ports := formatPorts(s.Ports)
+		if !holdsPorts(s) {
+			ports += " (released)"
+		}
+		row("Ports", ports)
+	}
+	row("Restart of", s.RestartOf)
+	row("Restart", s.Restart)
+	row("Idle timeout", s.IdleTimeout)
+	row("Max runtime", s.MaxRuntime)
+	if s.Alive {
+		if left, ok := timeLeft(s); ok {
+			row("Time left", formatDuration(int(left.Seconds())))
+		}
+	}
+	row("Started", formatTimestamp(s.StartedAt))
+	row("Last active", formatTimestamp(s.LastOutputAt))
+	if !s.Alive {
+		row("Ended", formatTimestamp(s.EndedAt))
+		if s.ExitCode != nil {
+			code := fmt.Sprintf("%d", *s.ExitCode)
+			if s.ExitSignal != "" {
+				code += " (" + s.ExitSignal + ")"
+			}
+			row("Exit code", code)
+		}
+		row("Exit reason", describeExitReason(s.ExitReason))
+	}
+	return nil
+}
+
+func describeExitReason(reason string) string {
+	switch reason {
+	case exitReasonExited:
+		return "ended without nt stopping it"
+	case exitReasonStopped:
+		return "stopped with nt stop"
+	case exitReasonKilled:
+		return "force killed by nt stop"
+	case exitReasonMemLimit:
+		return "went over its memory limit"
+	case exitReasonProcLimit:
+		return "ran into its process limit"
+	case exitReasonIdleTimeout:
+		return "stopped by the watchdog after going idle (--idle-timeout)"
+	case exitReasonMaxRuntime:
+		return "stopped by the watchdog after running too long (--max-runtime)"
+	}
+	return reason
+}
+
+// formatTimestamp renders an RFC 3339 timestamp in local time with a relative age.
+func formatTimestamp(isoTimestamp string) string {
+	t, err := time.Parse(time.RFC3339Nano, isoTimestamp)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", t.Local().Format("2006-01-02 15:04:05"), formatTimeAgo(isoTimestamp))
+}
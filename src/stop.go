@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Actions a stop sequence can take.
+const (
+	stopInterrupt = "interrupt" // type Ctrl-C into the session's PTY
+	stopHangup    = "hup"       // SIGHUP, what a closing terminal sends
+	stopTerm      = "term"      // SIGTERM
+	stopKill      = "kill"      // SIGKILL
+)
+
+type stopStep struct {
+	action  string
+	timeout time.Duration
+}
+
+// Default shutdown, "interrupt:2s,term:3s,kill:2s": Ctrl-C into the PTY so the
+// agent can exit cleanly, then SIGTERM, then SIGKILL. Each step waits up to its
+// timeout for the whole process tree to be gone before moving on.
+var defaultStopSequence = []stopStep{
+	{action: stopInterrupt, timeout: 2 * time.Second},
+	{action: stopTerm, timeout: 3 * time.Second},
+	{action: stopKill, timeout: 2 * time.Second},
+}
+
+// parseStopSequence parses a comma-separated list of action[:timeout] steps,
+// e.g. "interrupt:5s,term:3s,kill".
+func parseStopSequence(spec string) ([]stopStep, error) {
+	var steps []stopStep
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		action, timeoutStr, hasTimeout := strings.Cut(part, ":")
+		step := stopStep{action: action, timeout: time.Second}
+		switch action {
+		case stopInterrupt, stopHangup, stopTerm, stopKill:
+		default:
+			return nil, fmt.Errorf("unknown stop action %q (use interrupt, hup, term or kill)", action)
+		}
+		if hasTimeout {
+			d, err := parseDurationArg(timeoutStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout in stop step %q", part)
+			}
+			step.timeout = d
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty stop sequence")
+	}
+	return steps, nil
+}
+
+// formatStopSequence is the inverse of parseStopSequence.
+func formatStopSequence(seq []stopStep) string {
+	parts := make([]string, len(seq))
+	for i, step := range seq {
+		parts[i] = step.action + ":" + formatSetting(step.timeout)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseStopFlags pulls --sequence out of a command's arguments. Without it,
+// seq is nil and each session is stopped the way its repo's config says.
+func parseStopFlags(args []string) (rest []string, seq []stopStep, err error) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--sequence" && i+1 < len(args) {
+			seq, err = parseStopSequence(args[i+1])
+			if err != nil {
+				return nil, nil, err
+			}
+			i++
+		} else {
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, seq, nil
+}
+
+// processTracker remembers every process that has been part of a session's
+// tree, so descendants are still found after their parent exits and they are
+// reparented away.
+type processTracker struct {
+	root int
+	pids map[int]bool
+}
+
+// refresh picks up new descendants and forgets dead processes. Returns the
+// processes still running.
+func (t *processTracker) refresh() []int {
+	if isProcessAlive(t.root) {
+		for _, pid := range processTree(t.root) {
+			t.pids[pid] = true
+		}
+	}
+	var alive []int
+	for pid := range t.pids {
+		if isProcessAlive(pid) {
+			alive = append(alive, pid)
+		} else {
+			delete(t.pids, pid)
+		}
+	}
+	return alive
+}
+
+// signal sends sig to the root's process group first, which reaches children
+// forked since the last refresh, then to the tracked processes, which catches
+// those that left the group (job-control shells, setsid).
+func (t *processTracker) signal(alive []int, sig syscall.Signal) {
+	signalGroup(t.root, sig)
+	signalProcesses(alive, sig)
+}
+
+// waitGone polls until every tracked process has exited or timeout passes.
+func (t *processTracker) waitGone(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if len(t.refresh()) == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func stopSession(session *Session, sm *SessionManager, seq []stopStep) {
+	stopSessionAs(session, sm, seq, exitReasonStopped, os.Stdout)
+}
+
+// stopSessionAs stops a session, recording reason as why it ended unless it
+// has to be force killed. Progress messages go to out. A nil seq uses the
+// stop sequence configured for the session's repo.
+func stopSessionAs(session *Session, sm *SessionManager, seq []stopStep, reason string, out io.Writer) {
+	if !session.Alive || !isProcessAlive(session.PID) {
+		return
+	}
+	if seq == nil {
+		seq = defaultStopSequence
+		if cfg, err := loadSessionConfig(session); err == nil {
+			seq, _ = cfg.stopSequence() // already validated
+		}
+	}
+	fmt.Fprintf(out, "Stopping session %s (pid %d)...\n", session.ID, session.PID)
+	tracker := &processTracker{root: session.PID, pids: map[int]bool{}}
+	tracker.refresh()
+
+	notifyStop(session.ID, reason, sm)
+	for _, step := range seq {
+		alive := tracker.refresh()
+		if len(alive) == 0 {
+			break
+		}
+		switch step.action {
+		case stopInterrupt:
+			sendInput(session.ID, "\x03", sm) // best-effort; sessions without a control socket skip this
+		case stopHangup:
+			tracker.signal(alive, syscall.SIGHUP)
+		case stopTerm:
+			tracker.signal(alive, syscall.SIGTERM)
+		case stopKill:
+			fmt.Fprintf(out, "Force killing %d process(es)...\n", len(alive))
+			if reason == exitReasonStopped {
+				// Other reasons (like a timeout) say more about why than how
+				reason = exitReasonKilled
+				notifyStop(session.ID, reason, sm)
+			}
+			tracker.signal(alive, syscall.SIGKILL)
+		}
+		tracker.waitGone(step.timeout)
+	}
+	if alive := tracker.refresh(); len(alive) > 0 {
+		fmt.Fprintf(out, "Warning: %d process(es) from session %s are still running: %v\n", len(alive), session.ID, alive)
+	}
+
+	// The session's own nt process records the exit status. Give it a moment,
+	// and only record the exit ourselves if it never does (e.g. it's gone too).
+	for i := 0; i < 10; i++ {
+		if latest, err := sm.Read(session.ID); err == nil && latest.EndedAt != "" {
+			*session = *latest
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	session.Alive = false
+	session.ExitReason = reason
+	session.EndedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	sm.Write(session) // best-effort
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// usageSampler turns cumulative CPU time into a CPU% by comparing each
+// session's process tree against the previous sample.
+type usageSampler struct {
+	prev map[string]usageSample
+}
+
+type usageSample struct {
+	pid int
+	at  time.Time
+	cpu time.Duration
+}
+
+func newUsageSampler() *usageSampler {
+	return &usageSampler{prev: map[string]usageSample{}}
+}
+
+// sample fills in CPUPercent, MemBytes and Procs on running sessions. CPU%
+// is relative to one core, like top, so a busy multi-threaded tree can
+// exceed 100%.
+func (u *usageSampler) sample(sessions []*Session) {
+	procs := listProcesses()
+	now := time.Now()
+	seen := map[string]bool{}
+	for _, s := range sessions {
+		s.CPUPercent = -1
+		if !s.Alive || !isProcessAlive(s.PID) {
+			continue
+		}
+		usage := treeUsage(procs, s.PID)
+		s.MemBytes = usage.rss
+		s.Procs = usage.procs
+		if prev, ok := u.prev[s.ID]; ok && prev.pid == s.PID {
+			elapsed := now.Sub(prev.at)
+			delta := usage.cpuTime - prev.cpu
+			if elapsed > 0 && delta >= 0 {
+				s.CPUPercent = float64(delta) / float64(elapsed) * 100
+			}
+		}
+		u.prev[s.ID] = usageSample{pid: s.PID, at: now, cpu: usage.cpuTime}
+		seen[s.ID] = true
+	}
+	for id := range u.prev {
+		if !seen[id] {
+			delete(u.prev, id)
+		}
+	}
+}
+
+func formatCPU(s *Session) string {
+	if !s.Alive || s.CPUPercent < 0 {
+		return "—"
+	}
+	return fmt.Sprintf("%.0f%%", s.CPUPercent)
+}
+
+func formatMem(s *Session) string {
+	if !s.Alive || s.MemBytes <= 0 {
+		return "—"
+	}
+	return formatBytes(s.MemBytes)
+}
+
+// formatBytes renders a size compactly: 812K, 340M, 1.2G.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%dM", n>>20)
+	default:
+		return fmt.Sprintf("%dK", n>>10)
+	}
+}
+
+// renderTop builds the nt top table: running sessions, heaviest CPU first.
+func renderTop(sessions []*Session) (string, int) {
+	var running []*Session
+	for _, s := range sessions {
+		if s.Alive {
+			running = append(running, s)
+		}
+	}
+	sort.SliceStable(running, func(i, j int) bool {
+		if running[i].CPUPercent != running[j].CPUPercent {
+			return running[i].CPUPercent > running[j].CPUPercent
+		}
+		return running[i].MemBytes > running[j].MemBytes
+	})
+
+	var b strings.Builder
+	lines := 0
+	b.WriteString("Sessions by usage")
+	lines++
+	if len(running) == 0 {
+		b.WriteString("\n  No running sessions.")
+		lines++
+	} else {
+		fmt.Fprintf(&b, "\n%-7s %-6s %-7s %-6s %-10s %-10s %-16s %s",
+			"SESSION", "CPU%", "MEM", "PROCS", "MODEL", "WORKTREE", "REPO", "DESCRIPTION")
+		lines++
+		for _, s := range running {
+			model := modelLabel(s)
+			wt := resolveWorktreeID(s)
+			fmt.Fprintf(&b, "\n%-7s %-6s %-7s %-6d %-10s %-10s %-16s %s",
+				s.ID, formatCPU(s), formatMem(s), s.Procs, model, wt, shortRepoPath(s.RepoPath), readDescription(s.WorkingCopyPath))
+			lines++
+		}
+	}
+
+	fmt.Fprintf(&b, "\n")
+	lines++
+	fmt.Fprintf(&b, "\n\033[2mCtrl+C to exit\033[0m")
+	lines++
+
+	return b.String(), lines
+}
@@ -1,24 +1,64 @@
 package main
 
+import (
+	"os"
+	"path/filepath"
+)
+
 type VcsBackend interface {
-	Detect(path string) bool
+	// Detect returns the nearest directory at or above path that holds the
+	// backend's metadata directory, or "" if there's none.
+	Detect(path string) string
 	GetRepoRoot(cwd string) (string, error)
 	GetCurrentBranch(repoPath string) (string, error)
 	BranchExists(repoPath string, branch string) bool
-	CreateWorkingCopy(repoPath string, worktreeID string) (string, error)
+	CreateWorkingCopy(repoPath string, worktreeID string, wtPath string) error
 	Merge(repoPath string, sourceBranch string, branch string) bool
-	RemoveWorkingCopy(repoPath string, worktreeID string)
+	RemoveWorkingCopy(repoPath string, worktreeID string, wtPath string)
+	// Status lists uncommitted changes in a working copy, one per line; "" when clean.
+	Status(path string) (string, error)
+	// CommitsAhead counts the commits on branch that base doesn't have.
+	CommitsAhead(repoPath string, base string, branch string) (int, error)
+}
+
+// workingCopyMerger is implemented by backends whose Merge takes a worktree's
+// uncommitted changes along with its commits, so merging doesn't lose them.
+type workingCopyMerger interface {
+	MergesWorkingCopy() bool
 }
 
+// vcsBackends in order of preference when two find a repo at the same
+// directory. jj comes first: a colocated jj repo also has a .git directory.
 var vcsBackends = []VcsBackend{
+	&JjBackend{},
 	&GitBackend{},
+	&HgBackend{},
 }
 
+// detectVcs picks the backend whose repo is closest to cwd, so an hg repo
+// inside a git checkout (say, dotfiles in $HOME) is treated as hg.
 func detectVcs(cwd string) VcsBackend {
+	var found VcsBackend
+	nearest := ""
 	for _, b := range vcsBackends {
-		if b.Detect(cwd) {
-			return b
+		if dir := b.Detect(cwd); dir != "" && len(dir) > len(nearest) {
+			found, nearest = b, dir
+		}
+	}
+	return found
+}
+
+// findMarker walks up from path to the first directory containing name.
+func findMarker(path string, name string) string {
+	current := path
+	for {
+		if _, err := os.Stat(filepath.Join(current, name)); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return ""
 		}
+		current = parent
 	}
-	return nil
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// How often the watchdog checks a session's timeouts.
+const watchdogInterval = time.Second
+
+// startWatchdog stops the session through the normal stop sequence once it
+// has gone idle longer than idle or run longer than maxRuntime. Zero
+// disables either check.
+func (b *PtyBridge) startWatchdog(idle, maxRuntime time.Duration) {
+	if idle <= 0 && maxRuntime <= 0 {
+		return
+	}
+	started := time.Now()
+	b.watchdogDone = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(watchdogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.watchdogDone:
+				return
+			case now := <-ticker.C:
+				reason, limit := "", time.Duration(0)
+				if maxRuntime > 0 && now.Sub(started) >= maxRuntime {
+					reason, limit = exitReasonMaxRuntime, maxRuntime
+				} else if idle > 0 && now.Sub(b.LastOutput()) >= idle {
+					reason, limit = exitReasonIdleTimeout, idle
+				}
+				if reason == "" {
+					continue
+				}
+				b.stopForTimeout(reason, limit)
+				return
+			}
+		}
+	}()
+}
+
+func (b *PtyBridge) stopForTimeout(reason string, limit time.Duration) {
+	what := "idle for"
+	if reason == exitReasonMaxRuntime {
+		what = "running for"
+	}
+	b.writeNotice(fmt.Sprintf("Session has been %s %s; stopping it.", what, limit))
+
+	b.stopMu.Lock()
+	b.stopReason = reason // in case the control socket is unavailable
+	b.stopMu.Unlock()
+
+	// Work on a fresh copy: the bridge's own session is updated concurrently
+	session, err := b.sessionManager.Read(b.session.ID)
+	if err != nil {
+		return
+	}
+	stopSessionAs(session, b.sessionManager, nil, reason, io.Discard)
+}
+
+// timeLeft is how long until the watchdog would stop s, or false if it has
+// no timeouts.
+func timeLeft(s *Session) (time.Duration, bool) {
+	idle, maxRuntime := s.timeouts()
+	var left time.Duration
+	found := false
+	if maxRuntime > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, s.StartedAt); err == nil {
+			left, found = maxRuntime-time.Since(t), true
+		}
+	}
+	if idle > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, s.LastOutputAt); err == nil {
+			if l := idle - time.Since(t); !found || l < left {
+				left, found = l, true
+			}
+		}
+	}
+	return max(left, 0), found
+}
+
+func formatTimeLeft(s *Session) string {
+	if !s.Alive {
+		return "—"
+	}
+	left, ok := timeLeft(s)
+	if !ok {
+		return "—"
+	}
+	return formatDuration(int(left.Seconds()))
+}
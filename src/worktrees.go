@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// worktreeRecord is a registry entry: where a repo's worktree was created.
+// Worktrees are found through the registry rather than by assuming a fixed
+// directory, so they stay visible after worktreeRoot changes.
+type worktreeRecord struct {
+	Repo string `json:"repo"`
+	ID   string `json:"id"`
+	Path string `json:"path"`
+}
+
+// worktreeRegistryDir holds one record file per worktree, so concurrent nt
+// processes never rewrite each other's entries.
+func worktreeRegistryDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".nanotown", "worktrees")
+}
+
+func worktreeRecordPath(wtPath string) string {
+	sum := sha256.Sum256([]byte(wtPath))
+	return filepath.Join(worktreeRegistryDir(), fmt.Sprintf("%s-%x.json", filepath.Base(wtPath), sum[:6]))
+}
+
+// worktreeBase returns the directory new worktrees for a repo are created
+// in: .nanotown/ in the repo, or <worktreeRoot>/<repo name>-<hash> when
+// configured. The hash of the repo path keeps two repos with the same name
+// out of each other's directory.
+func worktreeBase(repoPath string, cfg repoConfig) string {
+	if cfg.WorktreeRoot == "" {
+		return filepath.Join(repoPath, worktreeDir)
+	}
+	root := cfg.WorktreeRoot
+	if root == "~" || strings.HasPrefix(root, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			root = filepath.Join(home, root[1:])
+		}
+	}
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(repoPath, root)
+	}
+	sum := sha256.Sum256([]byte(repoPath))
+	return filepath.Join(root, fmt.Sprintf("%s-%x", filepath.Base(repoPath), sum[:4]))
+}
+
+func registerWorktree(repoPath, worktreeID, wtPath string) error {
+	data, err := json.MarshalIndent(worktreeRecord{Repo: repoPath, ID: worktreeID, Path: wtPath}, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(worktreeRegistryDir(), 0755)
+	if err := os.WriteFile(worktreeRecordPath(wtPath), data, 0644); err != nil {
+		return fmt.Errorf("failed to register worktree %s: %w", worktreeID, err)
+	}
+	return nil
+}
+
+func unregisterWorktree(wtPath string) {
+	os.Remove(worktreeRecordPath(wtPath))
+}
+
+// repoWorktrees lists a repo's worktrees: the registered ones, plus any
+// directories under the repo's own .nanotown/ (worktrees from before the
+// registry). A directory under worktreeRoot is only ever trusted through its
+// record, since the root is shared with other repos. Records whose directory
+// is gone are dropped; those we can't reach right now (an unmounted drive)
+// are left out but kept.
+func repoWorktrees(repoPath string) []worktreeRecord {
+	seen := map[string]bool{}
+	var result []worktreeRecord
+	add := func(r worktreeRecord) {
+		if !seen[r.Path] {
+			seen[r.Path] = true
+			result = append(result, r)
+		}
+	}
+
+	entries, _ := os.ReadDir(worktreeRegistryDir())
+	for _, entry := range entries {
+		path := filepath.Join(worktreeRegistryDir(), entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var r worktreeRecord
+		if json.Unmarshal(data, &r) != nil || r.Repo != repoPath {
+			continue
+		}
+		if _, err := os.Stat(r.Path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				os.Remove(path)
+			}
+			continue
+		}
+		add(r)
+	}
+
+	legacy := filepath.Join(repoPath, worktreeDir)
+	entries, _ = os.ReadDir(legacy)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			add(worktreeRecord{Repo: repoPath, ID: entry.Name(), Path: filepath.Join(legacy, entry.Name())})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// findWorktree returns the path of a repo's worktree, or "" if it has none
+// by that ID.
+func findWorktree(repoPath, worktreeID string) string {
+	for _, wt := range repoWorktrees(repoPath) {
+		if wt.ID == worktreeID {
+			return wt.Path
+		}
+	}
+	return ""
+}